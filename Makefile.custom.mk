@@ -0,0 +1,13 @@
+##@ Modules
+
+# Backends with heavy dependencies live in nested modules, so users of the
+# core package do not inherit them. They are not covered by ./... of the root
+# module. They are tested against the local root module through the
+# modules.work workspace, which does not support -mod=mod.
+NESTED_MODULES := etcdstorage kubestorage redisstorage sqlstorage tracestorage
+
+.PHONY: test-modules
+test-modules: ## Runs go test in all nested modules.
+	@for m in $(NESTED_MODULES); do \
+		(cd $$m && GOWORK=$(CURDIR)/modules.work GOFLAGS="$(filter-out -mod=%,$(GOFLAGS))" go test -race ./...) || exit 1; \
+	done
@@ -0,0 +1,146 @@
+package microstorage
+
+import (
+	"context"
+
+	"github.com/giantswarm/microerror"
+)
+
+// BytesStorage is the byte slice oriented counterpart of Storage. Values are
+// arbitrary binary data and do not need to be encoded as text. Use
+// NewBytesStorage to get a BytesStorage for any Storage and NewStringStorage
+// for the opposite direction.
+type BytesStorage interface {
+	// PutBytes stores the given value under the given key. If the value
+	// under the key already exists PutBytes overrides it. The value is
+	// copied, so val can be modified afterwards.
+	PutBytes(ctx context.Context, key K, val []byte) error
+	// Delete removes the value stored under the given key.
+	Delete(ctx context.Context, key K) error
+	// Exists checks if a value under the given key exists or not.
+	Exists(ctx context.Context, key K) (bool, error)
+	// List does a lookup for all keys stored under the key, and returns the
+	// relative key path, if any. Use KV.Bytes to get the values.
+	List(ctx context.Context, key K) ([]KV, error)
+	// SearchBytes does a lookup for the value stored under key and returns
+	// a copy of it, if any.
+	SearchBytes(ctx context.Context, key K) ([]byte, error)
+}
+
+// NewBytesStorage returns a BytesStorage backed by the given Storage. When
+// the Storage implements BytesStorage natively it is returned as it is.
+func NewBytesStorage(storage Storage) BytesStorage {
+	if b, ok := storage.(BytesStorage); ok {
+		return b
+	}
+
+	return &bytesAdapter{storage: storage}
+}
+
+// NewStringStorage returns a Storage backed by the given BytesStorage. When
+// the BytesStorage implements Storage natively it is returned as it is.
+func NewStringStorage(storage BytesStorage) Storage {
+	if s, ok := storage.(Storage); ok {
+		return s
+	}
+
+	return &stringAdapter{storage: storage}
+}
+
+type bytesAdapter struct {
+	storage Storage
+}
+
+func (a *bytesAdapter) PutBytes(ctx context.Context, key K, val []byte) error {
+	err := a.storage.Put(ctx, KV{key: key.Key(), val: string(val)})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *bytesAdapter) Delete(ctx context.Context, key K) error {
+	err := a.storage.Delete(ctx, key)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *bytesAdapter) Exists(ctx context.Context, key K) (bool, error) {
+	exists, err := a.storage.Exists(ctx, key)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return exists, nil
+}
+
+func (a *bytesAdapter) List(ctx context.Context, key K) ([]KV, error) {
+	list, err := a.storage.List(ctx, key)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return list, nil
+}
+
+func (a *bytesAdapter) SearchBytes(ctx context.Context, key K) ([]byte, error) {
+	kv, err := a.storage.Search(ctx, key)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return kv.Bytes(), nil
+}
+
+type stringAdapter struct {
+	storage BytesStorage
+}
+
+func (a *stringAdapter) Put(ctx context.Context, kv KV) error {
+	err := a.storage.PutBytes(ctx, K{key: kv.Key()}, kv.Bytes())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *stringAdapter) Delete(ctx context.Context, key K) error {
+	err := a.storage.Delete(ctx, key)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (a *stringAdapter) Exists(ctx context.Context, key K) (bool, error) {
+	exists, err := a.storage.Exists(ctx, key)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return exists, nil
+}
+
+func (a *stringAdapter) List(ctx context.Context, key K) ([]KV, error) {
+	list, err := a.storage.List(ctx, key)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return list, nil
+}
+
+func (a *stringAdapter) Search(ctx context.Context, key K) (KV, error) {
+	val, err := a.storage.SearchBytes(ctx, key)
+	if err != nil {
+		return KV{}, microerror.Mask(err)
+	}
+
+	return KV{key: key.Key(), val: string(val)}, nil
+}
@@ -0,0 +1,92 @@
+package microstorage_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/memory"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+// plainStorage hides all optional interfaces of the underlying storage.
+type plainStorage struct {
+	microstorage.Storage
+}
+
+// plainBytesStorage hides all optional interfaces of the underlying bytes
+// storage.
+type plainBytesStorage struct {
+	microstorage.BytesStorage
+}
+
+func newMemory(t *testing.T) *memory.Storage {
+	storage, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage
+}
+
+func TestKV_Bytes(t *testing.T) {
+	val := []byte{0x00, 0xff, 0xfe}
+
+	kv, err := microstorage.NewKVBytes("a/b", val)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if kv.Key() != "/a/b" {
+		t.Fatal("expected", "/a/b", "got", kv.Key())
+	}
+
+	val[0] = 0x01
+	if !bytes.Equal(kv.Bytes(), []byte{0x00, 0xff, 0xfe}) {
+		t.Fatal("expected", []byte{0x00, 0xff, 0xfe}, "got", kv.Bytes())
+	}
+
+	b := kv.Bytes()
+	b[0] = 0x01
+	if !bytes.Equal(kv.Bytes(), []byte{0x00, 0xff, 0xfe}) {
+		t.Fatal("expected", []byte{0x00, 0xff, 0xfe}, "got", kv.Bytes())
+	}
+
+	_, err = microstorage.NewKVBytes("", val)
+	if !microstorage.IsInvalidKey(err) {
+		t.Fatal("expected", microstorage.InvalidKeyError, "got", err)
+	}
+}
+
+func TestBytesStorage_Adapters(t *testing.T) {
+	m := newMemory(t)
+
+	if microstorage.NewBytesStorage(m) != microstorage.BytesStorage(m) {
+		t.Fatal("expected", "native bytes storage", "got", "adapter")
+	}
+	if microstorage.NewStringStorage(m) != microstorage.Storage(m) {
+		t.Fatal("expected", "native storage", "got", "adapter")
+	}
+
+	// Both adapters stacked on top of each other must behave like a
+	// regular storage.
+	bytesStorage := microstorage.NewBytesStorage(plainStorage{Storage: m})
+	storage := microstorage.NewStringStorage(plainBytesStorage{BytesStorage: bytesStorage})
+	storagetest.Test(t, storage)
+
+	ctx := context.Background()
+	k := microstorage.MustK(microstorage.NewK("binary"))
+	val := []byte{0x00, 0xff, 0xfe}
+
+	err := bytesStorage.PutBytes(ctx, k, val)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	kv, err := storage.Search(ctx, k)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if !bytes.Equal(kv.Bytes(), val) {
+		t.Fatal("expected", val, "got", kv.Bytes())
+	}
+}
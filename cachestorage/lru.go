@@ -0,0 +1,89 @@
+package cachestorage
+
+import (
+	"container/list"
+	"time"
+)
+
+// lru is a least recently used cache holding at most size entries. Entries
+// expire after the configured TTL. It is not safe for concurrent use.
+type lru struct {
+	size  int
+	ttl   time.Duration
+	clock func() time.Time
+
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	val     interface{}
+	expires time.Time
+}
+
+func newLRU(size int, ttl time.Duration, clock func() time.Time) *lru {
+	return &lru{
+		size:  size,
+		ttl:   ttl,
+		clock: clock,
+
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *lru) get(key string) (interface{}, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := e.Value.(*lruEntry)
+	if !c.clock().Before(entry.expires) {
+		c.removeElement(e)
+		return nil, false
+	}
+
+	c.order.MoveToFront(e)
+
+	return entry.val, true
+}
+
+func (c *lru) add(key string, val interface{}) {
+	expires := c.clock().Add(c.ttl)
+
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*lruEntry)
+		entry.val = val
+		entry.expires = expires
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, val: val, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *lru) remove(key string) {
+	if e, ok := c.entries[key]; ok {
+		c.removeElement(e)
+	}
+}
+
+func (c *lru) len() int {
+	return c.order.Len()
+}
+
+func (c *lru) purge() {
+	c.order.Init()
+	c.entries = map[string]*list.Element{}
+}
+
+func (c *lru) removeElement(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*lruEntry).key)
+}
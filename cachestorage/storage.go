@@ -0,0 +1,304 @@
+// Package cachestorage provides a storage implementation caching the results
+// of Search, Exists and List of an underlying storage in memory.
+//
+// The cache holds a bounded number of entries which expire after a
+// configured TTL. Writes made through the cache invalidate the cached results
+// for the written key as well as the cached List results of all its
+// ancestors. When the underlying storage supports microstorage.Watcher the
+// cache subscribes to all changes, so writes made by other processes
+// invalidate the cache too. Otherwise the TTL bounds how long results of such
+// writes may be stale.
+package cachestorage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+const (
+	// watchRetryInterval is the time waited before watching the underlying
+	// storage again after the watch failed or ended.
+	watchRetryInterval = time.Second
+
+	searchPrefix = "s"
+	existsPrefix = "e"
+	listPrefix   = "l"
+)
+
+// Config represents the configuration used to create a caching storage.
+type Config struct {
+	// Underlying is the storage results are cached for.
+	Underlying microstorage.Storage
+
+	// MaxEntries is the maximum number of cached results. The least recently
+	// used result is evicted first.
+	MaxEntries int
+	// TTL is the duration a result is cached for.
+	TTL time.Duration
+	// Clock returns the current time. It is used to expire results.
+	Clock func() time.Time
+}
+
+// DefaultConfig provides a default configuration to create a new caching
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Underlying: nil, // Required.
+
+		MaxEntries: 1024,
+		TTL:        time.Minute,
+		Clock:      time.Now,
+	}
+}
+
+// New creates a new configured caching storage. When the underlying storage
+// implements microstorage.Watcher the returned Storage watches it until
+// Close is called.
+func New(config Config) (*Storage, error) {
+	if config.Underlying == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Underlying must not be empty", config)
+	}
+	if config.MaxEntries <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.MaxEntries must be positive", config)
+	}
+	if config.TTL <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.TTL must be positive", config)
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Storage{
+		underlying: config.Underlying,
+
+		cache:  newLRU(config.MaxEntries, config.TTL, config.Clock),
+		mutex:  sync.Mutex{},
+		cancel: cancel,
+	}
+
+	if w, ok := config.Underlying.(microstorage.Watcher); ok {
+		s.wg.Add(1)
+		go s.watch(ctx, w)
+	}
+
+	return s, nil
+}
+
+// Storage is the caching storage.
+type Storage struct {
+	// Dependencies.
+
+	underlying microstorage.Storage
+
+	// Internals.
+
+	cache *lru
+	// generation is incremented on every invalidation. Results read from
+	// the underlying storage are only cached when no invalidation happened
+	// while they were read, so a stale result never overwrites a newer
+	// invalidation.
+	generation uint64
+	mutex      sync.Mutex
+
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	err := s.underlying.Put(ctx, kv)
+	// Invalidate even when the write failed because it might have been
+	// applied anyway.
+	s.invalidate(kv.Key())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	err := s.underlying.Delete(ctx, k)
+	s.invalidate(k.Key())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	cacheKey := existsPrefix + k.Key()
+
+	v, generation, ok := s.get(cacheKey)
+	if ok {
+		return v.(bool), nil
+	}
+
+	exists, err := s.underlying.Exists(ctx, k)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	s.add(generation, cacheKey, exists)
+
+	return exists, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	cacheKey := listPrefix + k.Key()
+
+	v, generation, ok := s.get(cacheKey)
+	if ok {
+		return copyList(v.([]microstorage.KV)), nil
+	}
+
+	list, err := s.underlying.List(ctx, k)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	s.add(generation, cacheKey, copyList(list))
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	cacheKey := searchPrefix + k.Key()
+
+	v, generation, ok := s.get(cacheKey)
+	if ok {
+		return v.(microstorage.KV), nil
+	}
+
+	kv, err := s.underlying.Search(ctx, k)
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	s.add(generation, cacheKey, kv)
+
+	return kv, nil
+}
+
+// Close stops watching the underlying storage. The Storage must not be used
+// after Close.
+func (s *Storage) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		s.wg.Wait()
+	})
+
+	return nil
+}
+
+// get returns the cached result together with the current generation.
+func (s *Storage) get(cacheKey string) (interface{}, uint64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, ok := s.cache.get(cacheKey)
+
+	return v, s.generation, ok
+}
+
+// add caches the result unless an invalidation happened since generation was
+// returned by get.
+func (s *Storage) add(generation uint64, cacheKey string, v interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if generation != s.generation {
+		return
+	}
+
+	s.cache.add(cacheKey, v)
+}
+
+// invalidate removes all cached results affected by a change of the given
+// sanitized key.
+func (s *Storage) invalidate(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.generation++
+
+	s.cache.remove(searchPrefix + key)
+	s.cache.remove(existsPrefix + key)
+	for _, a := range ancestors(key) {
+		s.cache.remove(listPrefix + a)
+	}
+}
+
+func (s *Storage) purge() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.generation++
+	s.cache.purge()
+}
+
+// watch invalidates the cache for every change reported by the underlying
+// storage. The whole cache is purged whenever the watch is established,
+// because changes made before, e.g. while a previous watch was down, were
+// missed. When the underlying storage turns out not to support watching,
+// e.g. because it wraps a storage which can not watch, watch returns and only
+// the TTL bounds staleness.
+func (s *Storage) watch(ctx context.Context, w microstorage.Watcher) {
+	defer s.wg.Done()
+
+	for {
+		ch, err := w.Watch(ctx, microstorage.RootKey)
+		if microstorage.IsNotSupported(err) {
+			return
+		} else if err == nil {
+			s.purge()
+
+			for e := range ch {
+				s.invalidate(e.KV.Key())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// ancestors returns the sanitized keys of all ancestors of the given
+// sanitized key, e.g. "/", "/a" and "/a/b" for "/a/b/c".
+func ancestors(key string) []string {
+	if key == "/" {
+		return nil
+	}
+
+	a := []string{"/"}
+	for i := 1; i < len(key); i++ {
+		if key[i] == '/' {
+			a = append(a, key[:i])
+		}
+	}
+
+	return a
+}
+
+// copyList makes sure callers can not modify cached results.
+func copyList(list []microstorage.KV) []microstorage.KV {
+	if list == nil {
+		return nil
+	}
+
+	c := make([]microstorage.KV, len(list))
+	copy(c, list)
+
+	return c
+}
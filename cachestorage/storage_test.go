@@ -0,0 +1,403 @@
+package cachestorage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/memory"
+	"github.com/giantswarm/microstorage/readonlystorage"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+// countingStorage counts the reads reaching the underlying storage. It hides
+// all optional interfaces of the underlying storage, so the cache does not
+// watch it.
+type countingStorage struct {
+	microstorage.Storage
+
+	reads int32
+}
+
+func (s *countingStorage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	atomic.AddInt32(&s.reads, 1)
+	return s.Storage.Exists(ctx, k)
+}
+
+func (s *countingStorage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	atomic.AddInt32(&s.reads, 1)
+	return s.Storage.List(ctx, k)
+}
+
+func (s *countingStorage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	atomic.AddInt32(&s.reads, 1)
+	return s.Storage.Search(ctx, k)
+}
+
+func newCountingStorage(t *testing.T) *countingStorage {
+	underlying, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return &countingStorage{Storage: underlying}
+}
+
+func Test_Storage(t *testing.T) {
+	underlying, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	config := DefaultConfig()
+	config.Underlying = underlying
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	defer storage.Close()
+
+	storagetest.Test(t, storage)
+}
+
+func Test_Storage_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	underlying := newCountingStorage(t)
+
+	config := DefaultConfig()
+	config.Underlying = underlying
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	defer storage.Close()
+
+	key := microstorage.MustK(microstorage.NewK("a/b"))
+	parent := microstorage.MustK(microstorage.NewK("a"))
+
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("a/b", "v1")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Reads are served from the cache after the first call.
+	for i := 0; i < 3; i++ {
+		kv, err := storage.Search(ctx, key)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if kv.Val() != "v1" {
+			t.Fatal("expected", "v1", "got", kv.Val())
+		}
+		list, err := storage.List(ctx, parent)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if len(list) != 1 {
+			t.Fatal("expected", 1, "got", len(list))
+		}
+		exists, err := storage.Exists(ctx, key)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if !exists {
+			t.Fatal("expected", true, "got", exists)
+		}
+	}
+	if n := atomic.SwapInt32(&underlying.reads, 0); n != 3 {
+		t.Fatal("expected", 3, "got", n)
+	}
+
+	// Writing a key invalidates its own results and the list of its
+	// parent.
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("a/b", "v2")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	kv, err := storage.Search(ctx, key)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if kv.Val() != "v2" {
+		t.Fatal("expected", "v2", "got", kv.Val())
+	}
+	list, err := storage.List(ctx, parent)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if len(list) != 1 || list[0].Val() != "v2" {
+		t.Fatal("expected", "v2", "got", list)
+	}
+	if n := atomic.SwapInt32(&underlying.reads, 0); n != 2 {
+		t.Fatal("expected", 2, "got", n)
+	}
+
+	// Deleting a key invalidates the root list too.
+	_, err = storage.List(ctx, microstorage.RootKey)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = storage.Delete(ctx, key)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	list, err = storage.List(ctx, microstorage.RootKey)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if len(list) != 0 {
+		t.Fatal("expected", 0, "got", len(list))
+	}
+	exists, err := storage.Exists(ctx, key)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if exists {
+		t.Fatal("expected", false, "got", exists)
+	}
+}
+
+func Test_Storage_Bounds(t *testing.T) {
+	ctx := context.Background()
+	clock := storagetest.NewClock()
+	underlying := newCountingStorage(t)
+
+	config := DefaultConfig()
+	config.Underlying = underlying
+	config.MaxEntries = 2
+	config.TTL = time.Minute
+	config.Clock = clock.Now
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	defer storage.Close()
+
+	a := microstorage.MustK(microstorage.NewK("a"))
+	b := microstorage.MustK(microstorage.NewK("b"))
+	c := microstorage.MustK(microstorage.NewK("c"))
+
+	exists := func(k microstorage.K) {
+		_, err := storage.Exists(ctx, k)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+	}
+
+	// The least recently used result of a is evicted by c.
+	exists(a)
+	exists(b)
+	exists(c)
+	exists(b)
+	exists(c)
+	if n := atomic.SwapInt32(&underlying.reads, 0); n != 3 {
+		t.Fatal("expected", 3, "got", n)
+	}
+	exists(a)
+	if n := atomic.SwapInt32(&underlying.reads, 0); n != 1 {
+		t.Fatal("expected", 1, "got", n)
+	}
+
+	// Results expire after the TTL.
+	clock.Add(59 * time.Second)
+	exists(a)
+	if n := atomic.SwapInt32(&underlying.reads, 0); n != 0 {
+		t.Fatal("expected", 0, "got", n)
+	}
+	clock.Add(time.Second)
+	exists(a)
+	if n := atomic.SwapInt32(&underlying.reads, 0); n != 1 {
+		t.Fatal("expected", 1, "got", n)
+	}
+}
+
+func Test_Storage_Watch(t *testing.T) {
+	ctx := context.Background()
+
+	underlying, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	config := DefaultConfig()
+	config.Underlying = underlying
+	config.TTL = time.Hour
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	defer storage.Close()
+
+	key := microstorage.MustK(microstorage.NewK("key"))
+
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "v1")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = storage.Search(ctx, key)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Writes bypassing the cache, e.g. made by another process, must
+	// become visible without waiting for the TTL. The write is repeated
+	// because the watch is established asynchronously.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err = underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "v2")))
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+
+		kv, err := storage.Search(ctx, key)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if kv.Val() == "v2" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expected", "v2", "got", kv.Val())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_Storage_WatchNotSupported(t *testing.T) {
+	ctx := context.Background()
+	counting := newCountingStorage(t)
+
+	// The wrapper implements microstorage.Watcher although the storage it
+	// wraps can not watch.
+	wrapperConfig := readonlystorage.DefaultConfig()
+	wrapperConfig.Underlying = counting
+	wrapperConfig.ReadOnly = false
+	wrapper, err := readonlystorage.New(wrapperConfig)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	config := DefaultConfig()
+	config.Underlying = wrapper
+	config.TTL = time.Hour
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	defer storage.Close()
+
+	// The watch gives up instead of retrying and purging the cache.
+	done := make(chan struct{})
+	go func() {
+		storage.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected", "watch to end", "got", "watch running")
+	}
+
+	storage.mutex.Lock()
+	generation := storage.generation
+	storage.mutex.Unlock()
+	if generation != 0 {
+		t.Fatal("expected", 0, "got", generation)
+	}
+
+	key := microstorage.MustK(microstorage.NewK("key"))
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "v1")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = storage.Search(ctx, key)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+	}
+	if reads := atomic.LoadInt32(&counting.reads); reads != 1 {
+		t.Fatal("expected", 1, "got", reads)
+	}
+}
+
+// delayedWatchStorage establishes the watch of the underlying storage only
+// when start is closed.
+type delayedWatchStorage struct {
+	*memory.Storage
+
+	start chan struct{}
+}
+
+func (s *delayedWatchStorage) Watch(ctx context.Context, k microstorage.K) (<-chan microstorage.Event, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.start:
+	}
+
+	return s.Storage.Watch(ctx, k)
+}
+
+func Test_Storage_WatchEstablished(t *testing.T) {
+	ctx := context.Background()
+
+	underlying, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	delayed := &delayedWatchStorage{Storage: underlying, start: make(chan struct{})}
+
+	config := DefaultConfig()
+	config.Underlying = delayed
+	config.TTL = time.Hour
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	defer storage.Close()
+
+	key := microstorage.MustK(microstorage.NewK("key"))
+
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "v1")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = storage.Search(ctx, key)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// The write is made before the watch is established, so it is never
+	// reported. The cache must be purged once the watch is established.
+	err = underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "v2")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	close(delayed.start)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		kv, err := storage.Search(ctx, key)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+		if kv.Val() == "v2" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expected", "v2", "got", kv.Val())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
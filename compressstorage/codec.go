@@ -0,0 +1,168 @@
+package compressstorage
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithm is a compression algorithm.
+type Algorithm string
+
+const (
+	AlgorithmGzip Algorithm = "gzip"
+	AlgorithmZstd Algorithm = "zstd"
+)
+
+// magic starts the header of stored values written by this package. It
+// begins with a NUL byte which never starts text values, so values written
+// before compression was enabled are still read as they are.
+const magic = "\x00msz"
+
+// Header bytes following magic identify the encoding of the payload.
+const (
+	encodingNone byte = 0
+	encodingGzip byte = 1
+	encodingZstd byte = 2
+)
+
+func (a Algorithm) valid() bool {
+	return a == AlgorithmGzip || a == AlgorithmZstd
+}
+
+func (a Algorithm) encoding() byte {
+	if a == AlgorithmZstd {
+		return encodingZstd
+	}
+	return encodingGzip
+}
+
+// The zstd encoder and decoder are shared by all storages of the package.
+// They are only used through the stateless EncodeAll and DecodeAll, so they
+// never need to be closed and storages hold no resources to release.
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil)
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+)
+
+// codec compresses and decompresses values. It is safe for concurrent use.
+type codec struct {
+	algorithm Algorithm
+	threshold int
+
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+}
+
+func newCodec(algorithm Algorithm, threshold int) (*codec, error) {
+	encoder, err := zstdEncoder()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	decoder, err := zstdDecoder()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	c := &codec{
+		algorithm: algorithm,
+		threshold: threshold,
+
+		zstdEncoder: encoder,
+		zstdDecoder: decoder,
+	}
+
+	return c, nil
+}
+
+// encode returns the value to store. Values below the threshold and values
+// which do not get smaller are stored as they are. The returned bool tells
+// whether the value was compressed.
+func (c *codec) encode(val string) (string, bool, error) {
+	if len(val) >= c.threshold {
+		compressed, err := c.compress([]byte(val))
+		if err != nil {
+			return "", false, microerror.Mask(err)
+		}
+
+		if len(magic)+1+len(compressed) < len(val) {
+			return magic + string(c.algorithm.encoding()) + string(compressed), true, nil
+		}
+	}
+
+	// A value which happens to start with the magic needs a header.
+	// Otherwise it would be mistaken for a compressed value when read.
+	if strings.HasPrefix(val, magic) {
+		return magic + string(encodingNone) + val, false, nil
+	}
+
+	return val, false, nil
+}
+
+// decode returns the original value of a stored value.
+func (c *codec) decode(stored string) (string, error) {
+	if !strings.HasPrefix(stored, magic) {
+		return stored, nil
+	}
+	if len(stored) < len(magic)+1 {
+		return "", microerror.Maskf(invalidValueError, "header too short")
+	}
+
+	payload := []byte(stored[len(magic)+1:])
+
+	switch stored[len(magic)] {
+	case encodingNone:
+		return string(payload), nil
+	case encodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return "", microerror.Maskf(invalidValueError, "%s", err)
+		}
+		defer r.Close()
+
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return "", microerror.Maskf(invalidValueError, "%s", err)
+		}
+
+		return string(b), nil
+	case encodingZstd:
+		b, err := c.zstdDecoder.DecodeAll(payload, nil)
+		if err != nil {
+			return "", microerror.Maskf(invalidValueError, "%s", err)
+		}
+
+		return string(b), nil
+	default:
+		return "", microerror.Maskf(invalidValueError, "unknown encoding %d", stored[len(magic)])
+	}
+}
+
+func (c *codec) compress(b []byte) ([]byte, error) {
+	switch c.algorithm {
+	case AlgorithmZstd:
+		return c.zstdEncoder.EncodeAll(b, nil), nil
+	default:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(b)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		err = w.Close()
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		return buf.Bytes(), nil
+	}
+}
@@ -0,0 +1,21 @@
+package compressstorage
+
+import "github.com/giantswarm/microerror"
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidValueError = &microerror.Error{
+	Kind: "invalidValueError",
+}
+
+// IsInvalidValue asserts invalidValueError.
+func IsInvalidValue(err error) bool {
+	return microerror.Cause(err) == invalidValueError
+}
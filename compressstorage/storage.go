@@ -0,0 +1,272 @@
+// Package compressstorage provides a storage implementation compressing
+// values before they are written to an underlying storage.
+//
+// Values at least as large as the configured threshold are compressed with
+// gzip or zstd and stored with a small header identifying the algorithm.
+// Values without the header are returned as they are, so data written
+// before compression was enabled stays readable. Values written with any of
+// the supported algorithms are readable regardless of the configured one.
+//
+// When values are encrypted too, compression must happen first, i.e. this
+// storage must wrap the encrypting one.
+package compressstorage
+
+import (
+	"context"
+
+	"github.com/giantswarm/microerror"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/internal/metrics"
+)
+
+const (
+	prometheusNamespace = "microstorage"
+	prometheusSubsystem = "compress"
+)
+
+// Config represents the configuration used to create a compressing storage.
+type Config struct {
+	// Underlying is the storage compressed values are stored in.
+	Underlying microstorage.Storage
+
+	// Algorithm is the compression algorithm used for new values.
+	Algorithm Algorithm
+	// Threshold is the size in bytes from which on values are compressed.
+	Threshold int
+
+	// Registerer the compression metrics are registered with. It defaults
+	// to prometheus.DefaultRegisterer. Storages with the same Namespace and
+	// ConstLabels share their metrics.
+	Registerer prometheus.Registerer
+	// Namespace of all metric names. It defaults to "microstorage".
+	Namespace string
+	// ConstLabels are added to all metrics, e.g. the name of the backend.
+	ConstLabels prometheus.Labels
+}
+
+// DefaultConfig provides a default configuration to create a new compressing
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Underlying: nil, // Required.
+
+		Algorithm: AlgorithmGzip,
+		Threshold: 1024,
+
+		Registerer:  prometheus.DefaultRegisterer,
+		Namespace:   prometheusNamespace,
+		ConstLabels: nil,
+	}
+}
+
+// New creates a new configured compressing storage.
+func New(config Config) (*Storage, error) {
+	if config.Underlying == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Underlying must not be empty", config)
+	}
+	if !config.Algorithm.valid() {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Algorithm must be one of %q or %q", config, AlgorithmGzip, AlgorithmZstd)
+	}
+	if config.Threshold < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Threshold must not be negative", config)
+	}
+
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	if config.Namespace == "" {
+		config.Namespace = prometheusNamespace
+	}
+
+	codec, err := newCodec(config.Algorithm, config.Threshold)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	uncompressedBytesTotal := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   config.Namespace,
+			Subsystem:   prometheusSubsystem,
+			Name:        "uncompressed_bytes_total",
+			Help:        "Total number of bytes of values before they were compressed.",
+			ConstLabels: config.ConstLabels,
+		},
+		[]string{"algorithm"},
+	)
+	c, err := metrics.Register(config.Registerer, uncompressedBytesTotal)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	uncompressedBytesTotal, ok := c.(*prometheus.CounterVec)
+	if !ok {
+		return nil, microerror.Maskf(invalidConfigError, "collector uncompressed_bytes_total registered already with a different type")
+	}
+
+	compressedBytesTotal := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   config.Namespace,
+			Subsystem:   prometheusSubsystem,
+			Name:        "compressed_bytes_total",
+			Help:        "Total number of bytes of values after they were compressed.",
+			ConstLabels: config.ConstLabels,
+		},
+		[]string{"algorithm"},
+	)
+	c, err = metrics.Register(config.Registerer, compressedBytesTotal)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	compressedBytesTotal, ok = c.(*prometheus.CounterVec)
+	if !ok {
+		return nil, microerror.Maskf(invalidConfigError, "collector compressed_bytes_total registered already with a different type")
+	}
+
+	compressionRatio := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   config.Namespace,
+			Subsystem:   prometheusSubsystem,
+			Name:        "ratio",
+			Help:        "Size of compressed values relative to their original size.",
+			Buckets:     prometheus.LinearBuckets(0.1, 0.1, 10),
+			ConstLabels: config.ConstLabels,
+		},
+		[]string{"algorithm"},
+	)
+	c, err = metrics.Register(config.Registerer, compressionRatio)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	compressionRatio, ok = c.(*prometheus.HistogramVec)
+	if !ok {
+		return nil, microerror.Maskf(invalidConfigError, "collector ratio registered already with a different type")
+	}
+
+	skippedTotal := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace:   config.Namespace,
+			Subsystem:   prometheusSubsystem,
+			Name:        "skipped_total",
+			Help:        "Total number of values stored uncompressed because they were too small or did not compress.",
+			ConstLabels: config.ConstLabels,
+		},
+	)
+	c, err = metrics.Register(config.Registerer, skippedTotal)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	skippedTotal, ok = c.(prometheus.Counter)
+	if !ok {
+		return nil, microerror.Maskf(invalidConfigError, "collector skipped_total registered already with a different type")
+	}
+
+	s := &Storage{
+		underlying: config.Underlying,
+
+		algorithm: config.Algorithm,
+
+		codec: codec,
+
+		uncompressedBytesTotal: uncompressedBytesTotal,
+		compressedBytesTotal:   compressedBytesTotal,
+		compressionRatio:       compressionRatio,
+		skippedTotal:           skippedTotal,
+	}
+
+	return s, nil
+}
+
+// Storage is the compressing storage.
+type Storage struct {
+	// Dependencies.
+
+	underlying microstorage.Storage
+
+	// Settings.
+
+	algorithm Algorithm
+
+	// Internals.
+
+	codec *codec
+
+	uncompressedBytesTotal *prometheus.CounterVec
+	compressedBytesTotal   *prometheus.CounterVec
+	compressionRatio       *prometheus.HistogramVec
+	skippedTotal           prometheus.Counter
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	val, compressed, err := s.codec.encode(kv.Val())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if compressed {
+		algorithm := string(s.algorithm)
+		s.uncompressedBytesTotal.WithLabelValues(algorithm).Add(float64(len(kv.Val())))
+		s.compressedBytesTotal.WithLabelValues(algorithm).Add(float64(len(val)))
+		s.compressionRatio.WithLabelValues(algorithm).Observe(float64(len(val)) / float64(len(kv.Val())))
+	} else {
+		s.skippedTotal.Inc()
+	}
+
+	err = s.underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV(kv.Key(), val)))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	err := s.underlying.Delete(ctx, k)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	exists, err := s.underlying.Exists(ctx, k)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	list, err := s.underlying.List(ctx, k)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	decoded := make([]microstorage.KV, 0, len(list))
+	for _, kv := range list {
+		val, err := s.codec.decode(kv.Val())
+		if err != nil {
+			return nil, microerror.Maskf(invalidValueError, "key=%s: %s", kv.Key(), err)
+		}
+
+		decoded = append(decoded, microstorage.MustKV(microstorage.NewKV(kv.Key(), val)))
+	}
+
+	return decoded, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	kv, err := s.underlying.Search(ctx, k)
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	val, err := s.codec.decode(kv.Val())
+	if err != nil {
+		return microstorage.KV{}, microerror.Maskf(invalidValueError, "key=%s: %s", kv.Key(), err)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(kv.Key(), val)), nil
+}
@@ -0,0 +1,214 @@
+package compressstorage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/memory"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func newStorage(t *testing.T, underlying microstorage.Storage, algorithm Algorithm, threshold int) *Storage {
+	config := DefaultConfig()
+	config.Underlying = underlying
+	config.Algorithm = algorithm
+	config.Threshold = threshold
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage
+}
+
+func newMemory(t *testing.T) *memory.Storage {
+	storage, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage
+}
+
+func Test_Storage(t *testing.T) {
+	for _, algorithm := range []Algorithm{AlgorithmGzip, AlgorithmZstd} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			storagetest.Test(t, newStorage(t, newMemory(t), algorithm, 0))
+		})
+	}
+}
+
+func Test_Storage_Compression(t *testing.T) {
+	large := strings.Repeat(`{"name":"value"},`, 1000)
+
+	testCases := []struct {
+		name               string
+		algorithm          Algorithm
+		val                string
+		expectedCompressed bool
+	}{
+		{
+			name:               "case 0: gzip compresses large value",
+			algorithm:          AlgorithmGzip,
+			val:                large,
+			expectedCompressed: true,
+		},
+		{
+			name:               "case 1: zstd compresses large value",
+			algorithm:          AlgorithmZstd,
+			val:                large,
+			expectedCompressed: true,
+		},
+		{
+			name:               "case 2: small value is stored as it is",
+			algorithm:          AlgorithmGzip,
+			val:                "small",
+			expectedCompressed: false,
+		},
+		{
+			name:               "case 3: value starting with the magic",
+			algorithm:          AlgorithmGzip,
+			val:                magic + "small",
+			expectedCompressed: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			underlying := newMemory(t)
+			storage := newStorage(t, underlying, tc.algorithm, 100)
+			k := microstorage.MustK(microstorage.NewK("key"))
+
+			err := storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", tc.val)))
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+
+			stored, err := underlying.Search(ctx, k)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			compressed := len(stored.Val()) < len(tc.val)
+			if compressed != tc.expectedCompressed {
+				t.Fatal("expected", tc.expectedCompressed, "got", compressed)
+			}
+
+			kv, err := storage.Search(ctx, k)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if kv.Val() != tc.val {
+				t.Fatal("expected", len(tc.val), "got", len(kv.Val()))
+			}
+
+			list, err := storage.List(ctx, microstorage.RootKey)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if len(list) != 1 || list[0].Val() != tc.val {
+				t.Fatal("expected", 1, "got", len(list))
+			}
+		})
+	}
+}
+
+func Test_Storage_Compatibility(t *testing.T) {
+	ctx := context.Background()
+	large := strings.Repeat("a", 1000)
+	underlying := newMemory(t)
+	k := microstorage.MustK(microstorage.NewK("key"))
+
+	// Values written before compression was enabled are readable.
+	err := underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", large)))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	kv, err := newStorage(t, underlying, AlgorithmGzip, 100).Search(ctx, k)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if kv.Val() != large {
+		t.Fatal("expected", large, "got", kv.Val())
+	}
+
+	// Values compressed with another algorithm than the configured one are
+	// readable.
+	err = newStorage(t, underlying, AlgorithmZstd, 100).Put(ctx, microstorage.MustKV(microstorage.NewKV("key", large)))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	kv, err = newStorage(t, underlying, AlgorithmGzip, 100).Search(ctx, k)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if kv.Val() != large {
+		t.Fatal("expected", large, "got", kv.Val())
+	}
+
+	// Corrupted values are detected.
+	err = underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", magic+"\x01garbage")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = newStorage(t, underlying, AlgorithmGzip, 100).Search(ctx, k)
+	if !IsInvalidValue(err) {
+		t.Fatal("expected", invalidValueError, "got", err)
+	}
+}
+
+func Test_Storage_Metrics(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+
+	config := DefaultConfig()
+	config.Underlying = newMemory(t)
+	config.Algorithm = AlgorithmZstd
+	config.Threshold = 100
+	config.Registerer = registry
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("a", strings.Repeat("a", 1000))))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("b", "small")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	expected := `
+# HELP microstorage_compress_skipped_total Total number of values stored uncompressed because they were too small or did not compress.
+# TYPE microstorage_compress_skipped_total counter
+microstorage_compress_skipped_total 1
+# HELP microstorage_compress_uncompressed_bytes_total Total number of bytes of values before they were compressed.
+# TYPE microstorage_compress_uncompressed_bytes_total counter
+microstorage_compress_uncompressed_bytes_total{algorithm="zstd"} 1000
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "microstorage_compress_skipped_total", "microstorage_compress_uncompressed_bytes_total")
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+}
+
+func Test_Storage_SharedZstd(t *testing.T) {
+	a := newStorage(t, newMemory(t), AlgorithmZstd, 0)
+	b := newStorage(t, newMemory(t), AlgorithmZstd, 0)
+
+	if a.codec.zstdEncoder != b.codec.zstdEncoder {
+		t.Fatal("expected", "shared zstd encoder", "got", "separate encoders")
+	}
+	if a.codec.zstdDecoder != b.codec.zstdDecoder {
+		t.Fatal("expected", "shared zstd decoder", "got", "separate decoders")
+	}
+}
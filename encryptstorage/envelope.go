@@ -0,0 +1,163 @@
+package encryptstorage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+)
+
+const (
+	// envelopePrefix marks encrypted values and the version of their
+	// format.
+	envelopePrefix = "enc1:"
+
+	dataKeySize = 32
+)
+
+var encoding = base64.RawURLEncoding
+
+// envelope is an encrypted value. The value is encrypted with a random data
+// key which is in turn encrypted with the master key identified by keyID.
+// Its string form is
+//
+//	enc1:<keyID>:<encrypted data key>:<encrypted value>
+//
+// where both encrypted parts are base64 encoded and prefixed with their
+// nonce.
+type envelope struct {
+	keyID   string
+	dataKey []byte
+	value   []byte
+}
+
+func (e envelope) String() string {
+	return envelopePrefix + e.keyID + ":" + encoding.EncodeToString(e.dataKey) + ":" + encoding.EncodeToString(e.value)
+}
+
+// isEnvelope tells whether the stored value is encrypted.
+func isEnvelope(s string) bool {
+	return strings.HasPrefix(s, envelopePrefix)
+}
+
+func parseEnvelope(s string) (envelope, error) {
+	if !isEnvelope(s) {
+		return envelope{}, microerror.Maskf(decryptionFailedError, "value is not encrypted")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(s, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return envelope{}, microerror.Maskf(decryptionFailedError, "malformed envelope")
+	}
+
+	dataKey, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return envelope{}, microerror.Maskf(decryptionFailedError, "malformed data key")
+	}
+	value, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return envelope{}, microerror.Maskf(decryptionFailedError, "malformed value")
+	}
+
+	e := envelope{
+		keyID:   parts[0],
+		dataKey: dataKey,
+		value:   value,
+	}
+
+	return e, nil
+}
+
+// seal encrypts the value under a new data key. The data key is encrypted
+// with the master key. The storage key is authenticated along with the value,
+// so an encrypted value can not be moved to another key unnoticed.
+func seal(key Key, storageKey, value string) (envelope, error) {
+	dataKey := make([]byte, dataKeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return envelope{}, microerror.Mask(err)
+	}
+
+	wrapped, err := encrypt(key.Secret, dataKey, []byte(key.ID))
+	if err != nil {
+		return envelope{}, microerror.Mask(err)
+	}
+	sealed, err := encrypt(dataKey, []byte(value), []byte(storageKey))
+	if err != nil {
+		return envelope{}, microerror.Mask(err)
+	}
+
+	e := envelope{
+		keyID:   key.ID,
+		dataKey: wrapped,
+		value:   sealed,
+	}
+
+	return e, nil
+}
+
+// open decrypts the value with the given master key.
+func open(key Key, storageKey string, e envelope) (string, error) {
+	dataKey, err := decrypt(key.Secret, e.dataKey, []byte(key.ID))
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	value, err := decrypt(dataKey, e.value, []byte(storageKey))
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return string(value), nil
+}
+
+// encrypt encrypts plaintext with AES-GCM and returns it prefixed with the
+// random nonce.
+func encrypt(secret, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func decrypt(secret, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, microerror.Maskf(decryptionFailedError, "ciphertext too short")
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, microerror.Maskf(decryptionFailedError, "%s", err)
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return aead, nil
+}
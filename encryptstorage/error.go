@@ -0,0 +1,30 @@
+package encryptstorage
+
+import "github.com/giantswarm/microerror"
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var decryptionFailedError = &microerror.Error{
+	Kind: "decryptionFailedError",
+}
+
+// IsDecryptionFailed asserts decryptionFailedError.
+func IsDecryptionFailed(err error) bool {
+	return microerror.Cause(err) == decryptionFailedError
+}
+
+var unknownKeyError = &microerror.Error{
+	Kind: "unknownKeyError",
+}
+
+// IsUnknownKey asserts unknownKeyError.
+func IsUnknownKey(err error) bool {
+	return microerror.Cause(err) == unknownKeyError
+}
@@ -0,0 +1,284 @@
+// Package encryptstorage provides a storage implementation encrypting values
+// before they are written to an underlying storage.
+//
+// Values are encrypted with AES-GCM using envelope encryption. Every value is
+// encrypted with its own random data key, which is stored next to the value
+// encrypted with the current master key. The ID of the master key is stored
+// in plain text, so values encrypted with older master keys can still be
+// decrypted after the current key is rotated. ReEncrypt moves all values
+// over to the current master key.
+//
+// Keys are not encrypted. Values are bound to the key they are stored under,
+// so decryption fails when an encrypted value is copied to another key.
+package encryptstorage
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+var keyIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Key is a master key used to encrypt data keys.
+type Key struct {
+	// ID identifies the key in encrypted values. It must stay the same for
+	// the lifetime of the key and must be unique among all keys.
+	ID string
+	// Secret is the AES key. It must be 16, 24 or 32 bytes long.
+	Secret []byte
+}
+
+// Config represents the configuration used to create an encrypting storage.
+type Config struct {
+	// Underlying is the storage encrypted values are stored in.
+	Underlying microstorage.Storage
+
+	// Key is the master key values are encrypted with.
+	Key Key
+	// OldKeys are master keys which were used before. They are only used to
+	// decrypt values.
+	OldKeys []Key
+	// AllowPlaintext makes the storage return values which are not
+	// encrypted as they are, instead of failing. Use it when starting to
+	// encrypt an existing key space, followed by ReEncrypt.
+	AllowPlaintext bool
+}
+
+// DefaultConfig provides a default configuration to create a new encrypting
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Underlying: nil, // Required.
+
+		Key:            Key{}, // Required.
+		OldKeys:        nil,
+		AllowPlaintext: false,
+	}
+}
+
+// New creates a new configured encrypting storage.
+func New(config Config) (*Storage, error) {
+	if config.Underlying == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Underlying must not be empty", config)
+	}
+
+	keys := map[string]Key{}
+	for _, k := range append([]Key{config.Key}, config.OldKeys...) {
+		if !keyIDRegexp.MatchString(k.ID) {
+			return nil, microerror.Maskf(invalidConfigError, "key ID %q must match %s", k.ID, keyIDRegexp)
+		}
+		switch len(k.Secret) {
+		case 16, 24, 32:
+		default:
+			return nil, microerror.Maskf(invalidConfigError, "key %q must be 16, 24 or 32 bytes long", k.ID)
+		}
+		if _, ok := keys[k.ID]; ok {
+			return nil, microerror.Maskf(invalidConfigError, "key ID %q must be unique", k.ID)
+		}
+
+		keys[k.ID] = k
+	}
+
+	s := &Storage{
+		underlying: config.Underlying,
+
+		key:            config.Key,
+		keys:           keys,
+		allowPlaintext: config.AllowPlaintext,
+	}
+
+	return s, nil
+}
+
+// Storage is the encrypting storage.
+type Storage struct {
+	// Dependencies.
+
+	underlying microstorage.Storage
+
+	// Settings.
+
+	key            Key
+	keys           map[string]Key
+	allowPlaintext bool
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	val, err := s.encrypt(kv.Key(), kv.Val())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = s.underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV(kv.Key(), val)))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	err := s.underlying.Delete(ctx, k)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	exists, err := s.underlying.Exists(ctx, k)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	list, err := s.underlying.List(ctx, k)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	decrypted := make([]microstorage.KV, 0, len(list))
+	for _, kv := range list {
+		val, _, err := s.decrypt(absoluteKey(k, kv), kv.Val())
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		decrypted = append(decrypted, microstorage.MustKV(microstorage.NewKV(kv.Key(), val)))
+	}
+
+	return decrypted, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	kv, err := s.underlying.Search(ctx, k)
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	val, _, err := s.decrypt(k.Key(), kv.Val())
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(kv.Key(), val)), nil
+}
+
+// ReEncrypt encrypts all values which are not encrypted with the current
+// master key with it. Old master keys can be removed from the configuration
+// afterwards. It returns the number of re-encrypted values.
+//
+// When the underlying storage implements microstorage.RevisionStorage,
+// values modified concurrently are left alone, because they were written
+// with the current master key already. Otherwise concurrent writes to the
+// same keys must be avoided while ReEncrypt runs.
+func (s *Storage) ReEncrypt(ctx context.Context) (int, error) {
+	list, err := s.underlying.List(ctx, microstorage.RootKey)
+	if err != nil {
+		return 0, microerror.Mask(err)
+	}
+
+	rs, revisions := s.underlying.(microstorage.RevisionStorage)
+
+	var n int
+	for _, kv := range list {
+		k := microstorage.MustK(microstorage.NewK(kv.Key()))
+
+		stored := kv
+		var rev int64
+		if revisions {
+			stored, rev, err = rs.SearchWithRevision(ctx, k)
+			if microstorage.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return n, microerror.Mask(err)
+			}
+		}
+
+		val, current, err := s.decrypt(k.Key(), stored.Val())
+		if err != nil {
+			return n, microerror.Mask(err)
+		}
+		if current {
+			continue
+		}
+
+		encrypted, err := s.encrypt(k.Key(), val)
+		if err != nil {
+			return n, microerror.Mask(err)
+		}
+		encryptedKV := microstorage.MustKV(microstorage.NewKV(k.Key(), encrypted))
+
+		if revisions {
+			_, err = rs.PutIfRevision(ctx, encryptedKV, rev)
+			if microstorage.IsConflict(err) || microstorage.IsNotFound(err) {
+				continue
+			}
+		} else {
+			err = s.underlying.Put(ctx, encryptedKV)
+		}
+		if err != nil {
+			return n, microerror.Mask(err)
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+func (s *Storage) encrypt(key, val string) (string, error) {
+	e, err := seal(s.key, key, val)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return e.String(), nil
+}
+
+// decrypt returns the decrypted value and whether it is encrypted with the
+// current master key.
+func (s *Storage) decrypt(key, val string) (string, bool, error) {
+	if !isEnvelope(val) {
+		if s.allowPlaintext {
+			return val, false, nil
+		}
+
+		return "", false, microerror.Maskf(decryptionFailedError, "value of key=%s is not encrypted", key)
+	}
+
+	e, err := parseEnvelope(val)
+	if err != nil {
+		return "", false, microerror.Maskf(decryptionFailedError, "key=%s: %s", key, err)
+	}
+
+	k, ok := s.keys[e.keyID]
+	if !ok {
+		return "", false, microerror.Maskf(unknownKeyError, "value of key=%s is encrypted with unknown key %q", key, e.keyID)
+	}
+
+	decrypted, err := open(k, key, e)
+	if err != nil {
+		return "", false, microerror.Maskf(decryptionFailedError, "key=%s: %s", key, err)
+	}
+
+	return decrypted, e.keyID == s.key.ID, nil
+}
+
+// absoluteKey returns the sanitized key of a value returned by List. The
+// keys of listed values are relative to the listed key.
+func absoluteKey(listed microstorage.K, kv microstorage.KV) string {
+	if listed.Key() == "/" {
+		return kv.Key()
+	}
+
+	return listed.Key() + kv.Key()
+}
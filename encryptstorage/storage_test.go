@@ -0,0 +1,239 @@
+package encryptstorage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/memory"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+var (
+	key1 = Key{ID: "key1", Secret: bytes.Repeat([]byte{1}, 32)}
+	key2 = Key{ID: "key2", Secret: bytes.Repeat([]byte{2}, 32)}
+)
+
+// plainStorage hides all optional interfaces of the underlying storage.
+type plainStorage struct {
+	microstorage.Storage
+}
+
+func newStorage(t *testing.T, underlying microstorage.Storage, key Key, oldKeys ...Key) *Storage {
+	config := DefaultConfig()
+	config.Underlying = underlying
+	config.Key = key
+	config.OldKeys = oldKeys
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage
+}
+
+func newMemory(t *testing.T) *memory.Storage {
+	storage, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage
+}
+
+func Test_Storage(t *testing.T) {
+	storagetest.Test(t, newStorage(t, newMemory(t), key1))
+}
+
+func Test_Storage_Encrypted(t *testing.T) {
+	ctx := context.Background()
+	underlying := newMemory(t)
+	storage := newStorage(t, underlying, key1)
+
+	err := storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("a/b", "secret")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	stored, err := underlying.Search(ctx, microstorage.MustK(microstorage.NewK("a/b")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if strings.Contains(stored.Val(), "secret") {
+		t.Fatal("expected", "encrypted value", "got", stored.Val())
+	}
+	if !strings.HasPrefix(stored.Val(), "enc1:key1:") {
+		t.Fatal("expected", "enc1:key1: prefix", "got", stored.Val())
+	}
+
+	// Moving an encrypted value to another key must be detected.
+	err = underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV("a/c", stored.Val())))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = storage.Search(ctx, microstorage.MustK(microstorage.NewK("a/c")))
+	if !IsDecryptionFailed(err) {
+		t.Fatal("expected", decryptionFailedError, "got", err)
+	}
+	_, err = storage.List(ctx, microstorage.MustK(microstorage.NewK("a")))
+	if !IsDecryptionFailed(err) {
+		t.Fatal("expected", decryptionFailedError, "got", err)
+	}
+
+	// Plain text values are rejected unless explicitly allowed.
+	err = underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV("a/c", "plain")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = storage.Search(ctx, microstorage.MustK(microstorage.NewK("a/c")))
+	if !IsDecryptionFailed(err) {
+		t.Fatal("expected", decryptionFailedError, "got", err)
+	}
+
+	config := DefaultConfig()
+	config.Underlying = underlying
+	config.Key = key1
+	config.AllowPlaintext = true
+	lenient, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	kv, err := lenient.Search(ctx, microstorage.MustK(microstorage.NewK("a/c")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if kv.Val() != "plain" {
+		t.Fatal("expected", "plain", "got", kv.Val())
+	}
+}
+
+func Test_Storage_Rotation(t *testing.T) {
+	testCases := []struct {
+		name       string
+		underlying func(t *testing.T) microstorage.Storage
+	}{
+		{
+			name: "case 0: revision storage",
+			underlying: func(t *testing.T) microstorage.Storage {
+				return newMemory(t)
+			},
+		},
+		{
+			name: "case 1: plain storage",
+			underlying: func(t *testing.T) microstorage.Storage {
+				return plainStorage{Storage: newMemory(t)}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			underlying := tc.underlying(t)
+
+			old := newStorage(t, underlying, key1)
+			for _, kv := range []microstorage.KV{
+				microstorage.MustKV(microstorage.NewKV("a", "1")),
+				microstorage.MustKV(microstorage.NewKV("a/b", "2")),
+				microstorage.MustKV(microstorage.NewKV("c", "3")),
+			} {
+				err := old.Put(ctx, kv)
+				if err != nil {
+					t.Fatal("expected", nil, "got", err)
+				}
+			}
+
+			// Values written with an unknown key can not be read.
+			_, err := newStorage(t, underlying, key2).Search(ctx, microstorage.MustK(microstorage.NewK("a")))
+			if !IsUnknownKey(err) {
+				t.Fatal("expected", unknownKeyError, "got", err)
+			}
+
+			// After rotation old values are still readable and new
+			// values are written with the new key.
+			rotated := newStorage(t, underlying, key2, key1)
+			err = rotated.Put(ctx, microstorage.MustKV(microstorage.NewKV("c", "4")))
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			kv, err := rotated.Search(ctx, microstorage.MustK(microstorage.NewK("a/b")))
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if kv.Val() != "2" {
+				t.Fatal("expected", "2", "got", kv.Val())
+			}
+
+			n, err := rotated.ReEncrypt(ctx)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if n != 2 {
+				t.Fatal("expected", 2, "got", n)
+			}
+
+			// The old key is not needed anymore.
+			current := newStorage(t, underlying, key2)
+			list, err := current.List(ctx, microstorage.RootKey)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			values := map[string]string{}
+			for _, kv := range list {
+				values[kv.Key()] = kv.Val()
+			}
+			expected := map[string]string{"/a": "1", "/a/b": "2", "/c": "4"}
+			for k, v := range expected {
+				if values[k] != v {
+					t.Fatal("expected", v, "got", values[k])
+				}
+			}
+			if len(values) != len(expected) {
+				t.Fatal("expected", len(expected), "got", len(values))
+			}
+		})
+	}
+}
+
+func Test_New(t *testing.T) {
+	testCases := []struct {
+		name    string
+		key     Key
+		oldKeys []Key
+	}{
+		{
+			name: "case 0: missing key",
+			key:  Key{},
+		},
+		{
+			name: "case 1: invalid key ID",
+			key:  Key{ID: "a:b", Secret: key1.Secret},
+		},
+		{
+			name: "case 2: invalid secret length",
+			key:  Key{ID: "key", Secret: []byte("short")},
+		},
+		{
+			name:    "case 3: duplicate key ID",
+			key:     key1,
+			oldKeys: []Key{key1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Underlying = newMemory(t)
+			config.Key = tc.key
+			config.OldKeys = tc.oldKeys
+
+			_, err := New(config)
+			if !IsInvalidConfig(err) {
+				t.Fatal("expected", invalidConfigError, "got", err)
+			}
+		})
+	}
+}
@@ -35,3 +35,58 @@ var InvalidKeyError = &microerror.Error{
 func IsInvalidKey(err error) bool {
 	return microerror.Cause(err) == InvalidKeyError
 }
+
+// NotSupportedError is exported as it is used by the interface implementations
+// in order to signal that an optional feature is not provided by the
+// underlying storage backend.
+var NotSupportedError = &microerror.Error{
+	Kind: "NotSupportedError",
+}
+
+// IsNotSupported asserts NotSupportedError. The library user's code should
+// use this public key matcher to verify if some storage error is of type
+// NotSupportedError.
+func IsNotSupported(err error) bool {
+	return microerror.Cause(err) == NotSupportedError
+}
+
+// ConflictError is exported as it is used by the interface implementations
+// in order to fulfil the API of conditional operations.
+var ConflictError = &microerror.Error{
+	Kind: "ConflictError",
+}
+
+// IsConflict asserts ConflictError. The library user's code should use this
+// public key matcher to verify if some storage error is of type
+// ConflictError.
+func IsConflict(err error) bool {
+	return microerror.Cause(err) == ConflictError
+}
+
+// TransientError is exported as it is used by the interface implementations
+// in order to signal that an operation failed temporarily and may succeed
+// when it is retried, e.g. because the backend was not reachable.
+var TransientError = &microerror.Error{
+	Kind: "TransientError",
+}
+
+// IsTransient asserts TransientError. The library user's code should use this
+// public key matcher to verify if some storage error is of type
+// TransientError.
+func IsTransient(err error) bool {
+	return microerror.Cause(err) == TransientError
+}
+
+// ReadOnlyError is exported as it is used by the interface implementations
+// in order to signal that a write was rejected because the storage is
+// read-only.
+var ReadOnlyError = &microerror.Error{
+	Kind: "ReadOnlyError",
+}
+
+// IsReadOnly asserts ReadOnlyError. The library user's code should use this
+// public key matcher to verify if some storage error is of type
+// ReadOnlyError.
+func IsReadOnly(err error) bool {
+	return microerror.Cause(err) == ReadOnlyError
+}
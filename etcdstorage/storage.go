@@ -0,0 +1,150 @@
+// Package etcdstorage provides an etcd v3 backed storage implementation.
+package etcdstorage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// Config represents the configuration used to create an etcd backed storage.
+type Config struct {
+	// Client is the etcd client used to access the cluster.
+	Client *clientv3.Client
+	// Prefix is the root prefix all keys are stored under. It is sanitized
+	// the same way as microstorage.K is. Empty prefix stores keys as they
+	// are.
+	Prefix string
+}
+
+// DefaultConfig provides a default configuration to create a new etcd backed
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Client: nil, // Required.
+		Prefix: "",
+	}
+}
+
+// New creates a new configured etcd storage.
+func New(config Config) (*Storage, error) {
+	if config.Client == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Client must not be empty", config)
+	}
+
+	var prefix string
+	if config.Prefix != "" {
+		var err error
+		prefix, err = microstorage.SanitizeKey(config.Prefix)
+		if err != nil {
+			return nil, microerror.Maskf(invalidConfigError, "%T.Prefix must be a valid key: %s", config, err)
+		}
+	}
+
+	storage := &Storage{
+		client: config.Client,
+		prefix: prefix,
+	}
+
+	return storage, nil
+}
+
+// Storage is the etcd backed storage.
+type Storage struct {
+	// Dependencies.
+
+	client *clientv3.Client
+
+	// Settings.
+
+	prefix string
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	_, err := s.client.Put(ctx, s.key(kv.Key()), kv.Val())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	_, err := s.client.Delete(ctx, s.key(k.Key()))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	res, err := s.client.Get(ctx, s.key(k.Key()), clientv3.WithCountOnly())
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return res.Count > 0, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	// Listing is a prefix range over the key with a trailing slash. This
+	// way keys which are not separated by slash are ignored. When there is
+	// a key stored like "foo/bar/baz", listing keys using "foo/ba" should
+	// not succeed. It also covers the root key, which results in keys
+	// without leading slash like in the memory storage.
+	prefix := s.prefix + k.Key()
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	res, err := s.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var list []microstorage.KV
+	for _, ev := range res.Kvs {
+		key := strings.TrimPrefix(string(ev.Key), prefix)
+		if key == "" {
+			continue
+		}
+
+		kv, err := microstorage.NewKV(key, string(ev.Value))
+		if microstorage.IsInvalidKey(err) {
+			// Skip keys not created by this storage, e.g. with
+			// double slashes.
+			continue
+		} else if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		list = append(list, kv)
+	}
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	key := k.Key()
+
+	res, err := s.client.Get(ctx, s.key(key))
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	if len(res.Kvs) == 0 {
+		return microstorage.KV{}, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(key, string(res.Kvs[0].Value))), nil
+}
+
+// key returns the etcd key for the given sanitized storage key.
+func (s *Storage) key(key string) string {
+	return s.prefix + key
+}
@@ -0,0 +1,142 @@
+package etcdstorage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func Test_Storage(t *testing.T) {
+	client := newTestClient(t)
+
+	testCases := []struct {
+		name   string
+		prefix string
+	}{
+		{
+			name:   "case 0: no prefix",
+			prefix: "",
+		},
+		{
+			name:   "case 1: prefix",
+			prefix: "/microstorage/test",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Client = client
+			config.Prefix = tc.prefix
+
+			storage, err := New(config)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			storagetest.Test(t, storage)
+		})
+	}
+}
+
+func Test_Storage_PrefixIsolation(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	newStorage := func(prefix string) *Storage {
+		config := DefaultConfig()
+		config.Client = client
+		config.Prefix = prefix
+
+		storage, err := New(config)
+		require.NoError(t, err)
+
+		return storage
+	}
+
+	// Prefixes are chosen so one is a string prefix of the other.
+	a := newStorage("isolation/app")
+	b := newStorage("isolation/app2")
+
+	kvA := microstorage.MustKV(microstorage.NewKV("key", "value-a"))
+	kvB := microstorage.MustKV(microstorage.NewKV("key", "value-b"))
+
+	require.NoError(t, a.Put(ctx, kvA))
+	require.NoError(t, b.Put(ctx, kvB))
+
+	gotKV, err := a.Search(ctx, kvA.K())
+	require.NoError(t, err)
+	require.Equal(t, kvA, gotKV)
+
+	list, err := a.List(ctx, microstorage.RootKey)
+	require.NoError(t, err)
+	require.Equal(t, []microstorage.KV{kvA}, list)
+
+	require.NoError(t, a.Delete(ctx, kvA.K()))
+
+	ok, err := b.Exists(ctx, kvB.K())
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func newTestClient(t *testing.T) *clientv3.Client {
+	t.Helper()
+
+	config := embed.NewConfig()
+	config.Dir = t.TempDir()
+	config.LogLevel = "error"
+	config.ListenClientUrls = []url.URL{freeURL(t)}
+	config.AdvertiseClientUrls = config.ListenClientUrls
+	config.ListenPeerUrls = []url.URL{freeURL(t)}
+	config.AdvertisePeerUrls = config.ListenPeerUrls
+	config.InitialCluster = config.InitialClusterFromName(config.Name)
+
+	e, err := embed.StartEtcd(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("timed out waiting for embedded etcd")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{config.ListenClientUrls[0].String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+func freeURL(t *testing.T) url.URL {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	defer l.Close()
+
+	u, err := url.Parse(fmt.Sprintf("http://%s", l.Addr().String()))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return *u
+}
@@ -0,0 +1,21 @@
+package filestorage
+
+import "github.com/giantswarm/microerror"
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidPathError = &microerror.Error{
+	Kind: "invalidPathError",
+}
+
+// IsInvalidPath asserts invalidPathError.
+func IsInvalidPath(err error) bool {
+	return microerror.Cause(err) == invalidPathError
+}
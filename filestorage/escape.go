@@ -0,0 +1,56 @@
+package filestorage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+)
+
+// escape makes a single key segment safe to be used as a file name. All bytes
+// except ASCII letters, digits, '-' and '_' are percent encoded. Escaped
+// segments therefore never start with a dot, which leaves all dot-prefixed
+// names free for internal files, and never form "." or "..".
+func escape(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		if isSafe(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// unescape reverses escape.
+func unescape(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+
+		if i+2 >= len(name) {
+			return "", microerror.Maskf(invalidPathError, "truncated escape sequence in %#q", name)
+		}
+		n, err := strconv.ParseUint(name[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", microerror.Maskf(invalidPathError, "invalid escape sequence in %#q", name)
+		}
+		b.WriteByte(byte(n))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func isSafe(c byte) bool {
+	return 'a' <= c && c <= 'z' ||
+		'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' ||
+		c == '-' || c == '_'
+}
@@ -0,0 +1,46 @@
+package filestorage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_escape(t *testing.T) {
+	testCases := []struct {
+		segment string
+		want    string
+	}{
+		{segment: "plain-key_01", want: "plain-key_01"},
+		{segment: ".", want: "%2E"},
+		{segment: "..", want: "%2E%2E"},
+		{segment: ".value", want: "%2Evalue"},
+		{segment: "with space", want: "with%20space"},
+		{segment: "100%", want: "100%25"},
+		{segment: `back\slash`, want: "back%5Cslash"},
+		{segment: "zażółć", want: "za%C5%BC%C3%B3%C5%82%C4%87"},
+	}
+
+	for _, tc := range testCases {
+		got := escape(tc.segment)
+		assert.Equal(t, tc.want, got, "segment=%q", tc.segment)
+
+		unescaped, err := unescape(got)
+		require.NoError(t, err, "segment=%q", tc.segment)
+		assert.Equal(t, tc.segment, unescaped, "segment=%q", tc.segment)
+	}
+}
+
+func Test_unescape_Invalid(t *testing.T) {
+	names := []string{
+		"%",
+		"%4",
+		"abc%G1",
+	}
+
+	for _, name := range names {
+		_, err := unescape(name)
+		assert.True(t, IsInvalidPath(err), "name=%q", name)
+	}
+}
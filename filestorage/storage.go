@@ -0,0 +1,313 @@
+// Package filestorage provides a filesystem backed storage implementation.
+//
+// Every key is mapped onto a directory tree below the configured root
+// directory, one directory per key segment. The value of a key is stored in a
+// file named ".value" inside the key's directory, so a key may hold a value
+// and have nested keys at the same time. Key segments are escaped, see escape.
+//
+// The storage is safe for concurrent use within a single process. It does not
+// coordinate with other processes using the same directory.
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+const (
+	valueFileName   = ".value"
+	tmpFilePattern  = ".tmp-*"
+	dirPermissions  = 0700
+	filePermissions = 0600
+)
+
+// Config represents the configuration used to create a filesystem backed
+// storage.
+type Config struct {
+	// Dir is the root directory of the storage. It is created when it does
+	// not exist.
+	Dir string
+}
+
+// DefaultConfig provides a default configuration to create a new filesystem
+// backed storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Dir: "", // Required.
+	}
+}
+
+// New creates a new configured filesystem storage.
+func New(config Config) (*Storage, error) {
+	if config.Dir == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Dir must not be empty", config)
+	}
+
+	dir, err := filepath.Abs(config.Dir)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	err = os.MkdirAll(dir, dirPermissions)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	storage := &Storage{
+		dir: dir,
+
+		mutex: sync.RWMutex{},
+	}
+
+	return storage, nil
+}
+
+// Storage is the filesystem backed storage.
+type Storage struct {
+	// Settings.
+
+	dir string
+
+	// Internals.
+
+	// mutex guards directory creation in Put against directory removal in
+	// Delete and makes sure readers never observe half applied changes.
+	mutex sync.RWMutex
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	dir := s.keyDir(kv.Key())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := os.MkdirAll(dir, dirPermissions)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = writeFileAtomic(filepath.Join(dir, valueFileName), []byte(kv.Val()))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	dir := s.keyDir(k.Key())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := os.Remove(filepath.Join(dir, valueFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	// Remove directories left empty after the value is deleted. Removal of
+	// a non empty directory fails which means there are still other keys
+	// nested under it.
+	for dir != s.dir {
+		err := os.Remove(dir)
+		if err != nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	p := filepath.Join(s.keyDir(k.Key()), valueFileName)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return true, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	root := s.keyDir(k.Key())
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var list []microstorage.KV
+
+	walk := func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == root {
+			return filepath.SkipDir
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+
+		if d.IsDir() || d.Name() != valueFileName {
+			return nil
+		}
+
+		dir := filepath.Dir(p)
+		if dir == root {
+			// The value of the listed key itself is not a part of
+			// the result. Only nested keys are.
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		key, err := unescapePath(rel)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		val, err := os.ReadFile(p)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		list = append(list, microstorage.MustKV(microstorage.NewKV(key, string(val))))
+
+		return nil
+	}
+
+	err := filepath.WalkDir(root, walk)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	key := k.Key()
+	p := filepath.Join(s.keyDir(key), valueFileName)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	val, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return microstorage.KV{}, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+	} else if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(key, string(val))), nil
+}
+
+// keyDir returns the directory holding the value of the given sanitized key.
+// The root key maps to the storage directory itself.
+func (s *Storage) keyDir(key string) string {
+	if key == "/" {
+		return s.dir
+	}
+
+	segments := strings.Split(key[1:], "/")
+	elems := make([]string, 0, len(segments)+1)
+	elems = append(elems, s.dir)
+	for _, segment := range segments {
+		elems = append(elems, escape(segment))
+	}
+
+	return filepath.Join(elems...)
+}
+
+// unescapePath turns a relative directory path back into a relative key.
+func unescapePath(rel string) (string, error) {
+	names := strings.Split(filepath.ToSlash(rel), "/")
+	segments := make([]string, 0, len(names))
+	for _, name := range names {
+		segment, err := unescape(name)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+		segments = append(segments, segment)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// writeFileAtomic writes data to a temporary file in the target directory,
+// flushes it to disk and renames it over the target path. The directory is
+// synced afterwards so the rename itself survives a crash.
+func writeFileAtomic(p string, data []byte) error {
+	dir := filepath.Dir(p)
+
+	f, err := os.CreateTemp(dir, tmpFilePattern)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	tmp := f.Name()
+
+	// Clean up the temporary file unless it is successfully renamed.
+	defer os.Remove(tmp)
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+	err = f.Chmod(filePermissions)
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+	err = f.Close()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = os.Rename(tmp, p)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = syncDir(dir)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer d.Close()
+
+	err = d.Sync()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
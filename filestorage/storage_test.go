@@ -0,0 +1,18 @@
+package filestorage
+
+import (
+	"testing"
+
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func Test_Storage(t *testing.T) {
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	storagetest.Test(t, storage)
+}
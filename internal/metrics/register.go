@@ -0,0 +1,23 @@
+// Package metrics provides helpers shared by the storages exposing
+// Prometheus metrics.
+package metrics
+
+import (
+	"github.com/giantswarm/microerror"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Register registers the collector with r. When an equal collector is
+// registered already, the existing one is returned, so multiple storages with
+// the same configuration share their metrics. Callers must check the type of
+// the returned collector, because the existing one may differ from c.
+func Register(r prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	err := r.Register(c)
+	if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		return are.ExistingCollector, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_Register(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	opts := prometheus.CounterOpts{Name: "test_total", Help: "Test counter."}
+
+	first := prometheus.NewCounter(opts)
+	c, err := Register(registry, first)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if c != first {
+		t.Fatal("expected", first, "got", c)
+	}
+
+	// An equal collector is shared.
+	c, err = Register(registry, prometheus.NewCounter(opts))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if c != first {
+		t.Fatal("expected", first, "got", c)
+	}
+
+	// A collector conflicting with a registered one is rejected.
+	_, err = Register(registry, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_total", Help: "Other help."}))
+	if err == nil {
+		t.Fatal("expected", "error", "got", nil)
+	}
+}
@@ -0,0 +1,32 @@
+package kubestorage
+
+import (
+	"github.com/giantswarm/microerror"
+)
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var valueTooLargeError = &microerror.Error{
+	Kind: "valueTooLargeError",
+}
+
+// IsValueTooLarge asserts valueTooLargeError.
+func IsValueTooLarge(err error) bool {
+	return microerror.Cause(err) == valueTooLargeError
+}
+
+var invalidObjectError = &microerror.Error{
+	Kind: "invalidObjectError",
+}
+
+// IsInvalidObject asserts invalidObjectError.
+func IsInvalidObject(err error) bool {
+	return microerror.Cause(err) == invalidObjectError
+}
@@ -0,0 +1,80 @@
+package kubestorage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// maxDataKeyLength is the maximum length of a ConfigMap or Secret data key.
+const maxDataKeyLength = 253
+
+// encodeKey turns a sanitized storage key into a ConfigMap or Secret data key.
+// Data keys may only consist of alphanumeric characters, '-', '_' and '.'.
+// The leading slash is dropped, the remaining slashes are replaced with '.'
+// and all other bytes except ASCII letters, digits and '-' are encoded as '_'
+// followed by two hex digits.
+func encodeKey(key string) (string, error) {
+	var b strings.Builder
+	for i := 1; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c == '/':
+			b.WriteByte('.')
+		case isSafe(c):
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "_%02X", c)
+		}
+	}
+
+	if b.Len() > maxDataKeyLength {
+		return "", microerror.Maskf(microstorage.InvalidKeyError, "key=%s exceeds %d bytes when encoded", key, maxDataKeyLength)
+	}
+
+	return b.String(), nil
+}
+
+// decodeKey reverses encodeKey. It fails for data keys not created by
+// encodeKey.
+func decodeKey(dataKey string) (string, error) {
+	var b strings.Builder
+	b.WriteByte('/')
+	for i := 0; i < len(dataKey); i++ {
+		c := dataKey[i]
+		switch {
+		case c == '.':
+			b.WriteByte('/')
+		case c == '_':
+			if i+2 >= len(dataKey) {
+				return "", microerror.Maskf(microstorage.InvalidKeyError, "truncated escape sequence in %#q", dataKey)
+			}
+			n, err := strconv.ParseUint(dataKey[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", microerror.Maskf(microstorage.InvalidKeyError, "invalid escape sequence in %#q", dataKey)
+			}
+			b.WriteByte(byte(n))
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	key, err := microstorage.SanitizeKey(b.String())
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return key, nil
+}
+
+func isSafe(c byte) bool {
+	return 'a' <= c && c <= 'z' ||
+		'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' ||
+		c == '-'
+}
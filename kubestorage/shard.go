@@ -0,0 +1,267 @@
+package kubestorage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/giantswarm/microerror"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// nameLabel selects all objects holding the key space of a storage.
+	nameLabel = "microstorage.giantswarm.io/name"
+	// shardAnnotation holds the index of the shard stored in an object.
+	shardAnnotation = "microstorage.giantswarm.io/shard"
+)
+
+// shard is a single ConfigMap or Secret holding a part of the key space.
+type shard struct {
+	index           int
+	name            string
+	resourceVersion string
+	// data maps encoded keys to values.
+	data map[string]string
+}
+
+// shardClient abstracts the differences between storing shards in
+// ConfigMaps and in Secrets.
+type shardClient interface {
+	list(ctx context.Context) ([]*shard, error)
+	create(ctx context.Context, s *shard) error
+	update(ctx context.Context, s *shard) error
+	delete(ctx context.Context, s *shard) error
+	// size returns the number of bytes a key-value pair adds to the
+	// serialized object.
+	size(key, val string) int
+}
+
+type configMapClient struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func (c *configMapClient) list(ctx context.Context) ([]*shard, error) {
+	list, err := c.client.CoreV1().ConfigMaps(c.namespace).List(ctx, listOptions(c.name))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var shards []*shard
+	for _, o := range list.Items {
+		index, err := shardIndex(o.ObjectMeta)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		data := make(map[string]string, len(o.Data)+len(o.BinaryData))
+		for k, v := range o.Data {
+			data[k] = v
+		}
+		for k, v := range o.BinaryData {
+			data[k] = string(v)
+		}
+
+		shards = append(shards, &shard{
+			index:           index,
+			name:            o.Name,
+			resourceVersion: o.ResourceVersion,
+			data:            data,
+		})
+	}
+
+	sortShards(shards)
+
+	return shards, nil
+}
+
+func (c *configMapClient) create(ctx context.Context, s *shard) error {
+	_, err := c.client.CoreV1().ConfigMaps(c.namespace).Create(ctx, c.object(s), metav1.CreateOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *configMapClient) update(ctx context.Context, s *shard) error {
+	_, err := c.client.CoreV1().ConfigMaps(c.namespace).Update(ctx, c.object(s), metav1.UpdateOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *configMapClient) delete(ctx context.Context, s *shard) error {
+	err := c.client.CoreV1().ConfigMaps(c.namespace).Delete(ctx, s.name, deleteOptions(s))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *configMapClient) size(key, val string) int {
+	return len(key) + len(val)
+}
+
+// object converts the shard into a ConfigMap. Values which are not valid
+// UTF-8 are stored in BinaryData because Data only accepts UTF-8 strings.
+func (c *configMapClient) object(s *shard) *corev1.ConfigMap {
+	o := &corev1.ConfigMap{
+		ObjectMeta: objectMeta(c.namespace, c.name, s),
+		Data:       map[string]string{},
+	}
+
+	for k, v := range s.data {
+		if utf8.ValidString(v) {
+			o.Data[k] = v
+			continue
+		}
+
+		if o.BinaryData == nil {
+			o.BinaryData = map[string][]byte{}
+		}
+		o.BinaryData[k] = []byte(v)
+	}
+
+	return o
+}
+
+type secretClient struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+func (c *secretClient) list(ctx context.Context) ([]*shard, error) {
+	list, err := c.client.CoreV1().Secrets(c.namespace).List(ctx, listOptions(c.name))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	var shards []*shard
+	for _, o := range list.Items {
+		index, err := shardIndex(o.ObjectMeta)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		data := make(map[string]string, len(o.Data))
+		for k, v := range o.Data {
+			data[k] = string(v)
+		}
+
+		shards = append(shards, &shard{
+			index:           index,
+			name:            o.Name,
+			resourceVersion: o.ResourceVersion,
+			data:            data,
+		})
+	}
+
+	sortShards(shards)
+
+	return shards, nil
+}
+
+func (c *secretClient) create(ctx context.Context, s *shard) error {
+	_, err := c.client.CoreV1().Secrets(c.namespace).Create(ctx, c.object(s), metav1.CreateOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *secretClient) update(ctx context.Context, s *shard) error {
+	_, err := c.client.CoreV1().Secrets(c.namespace).Update(ctx, c.object(s), metav1.UpdateOptions{})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (c *secretClient) delete(ctx context.Context, s *shard) error {
+	err := c.client.CoreV1().Secrets(c.namespace).Delete(ctx, s.name, deleteOptions(s))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// size accounts for Secret data being base64 encoded when serialized.
+func (c *secretClient) size(key, val string) int {
+	return len(key) + (len(val)+2)/3*4
+}
+
+func (c *secretClient) object(s *shard) *corev1.Secret {
+	o := &corev1.Secret{
+		ObjectMeta: objectMeta(c.namespace, c.name, s),
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{},
+	}
+
+	for k, v := range s.data {
+		o.Data[k] = []byte(v)
+	}
+
+	return o
+}
+
+func listOptions(name string) metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", nameLabel, name),
+	}
+}
+
+// deleteOptions makes sure a shard is only deleted when it was not modified
+// concurrently.
+func deleteOptions(s *shard) metav1.DeleteOptions {
+	return metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			ResourceVersion: &s.resourceVersion,
+		},
+	}
+}
+
+func objectMeta(namespace, name string, s *shard) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      s.name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			nameLabel: name,
+		},
+		Annotations: map[string]string{
+			shardAnnotation: strconv.Itoa(s.index),
+		},
+		ResourceVersion: s.resourceVersion,
+	}
+}
+
+func shardIndex(m metav1.ObjectMeta) (int, error) {
+	index, err := strconv.Atoi(m.Annotations[shardAnnotation])
+	if err != nil {
+		return 0, microerror.Maskf(invalidObjectError, "object %s/%s has invalid %s annotation", m.Namespace, m.Name, shardAnnotation)
+	}
+
+	return index, nil
+}
+
+func shardName(name string, index int) string {
+	return strings.Join([]string{name, strconv.Itoa(index)}, "-")
+}
+
+func sortShards(shards []*shard) {
+	sort.Slice(shards, func(i, j int) bool { return shards[i].index < shards[j].index })
+}
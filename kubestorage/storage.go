@@ -0,0 +1,389 @@
+// Package kubestorage provides a storage implementation backed by Kubernetes
+// ConfigMaps or Secrets.
+//
+// The key space is sharded across objects named "<name>-<index>" which are
+// labeled with the configured name. Every shard is kept below the configured
+// size so the object size limit of the API server is never hit. All writes
+// are done with the resourceVersion read before, so concurrent modifications
+// are detected and the operation is retried with fresh data.
+//
+// When a value does not fit into its current shard anymore it is moved into
+// a shard with a higher index. The value is written to the new shard before
+// it is removed from the old one. Should the storage find the same key in
+// multiple shards, e.g. after a crash in between, the value from the shard
+// with the highest index wins.
+package kubestorage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/giantswarm/microerror"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/giantswarm/microstorage"
+)
+
+const (
+	// DefaultMaxShardSize leaves enough headroom below the 1 MiB object size
+	// limit for object metadata and serialization overhead.
+	DefaultMaxShardSize = 900 * 1024
+
+	// conflictRetries is the number of attempts made when a write conflicts
+	// with a concurrent modification.
+	conflictRetries = 5
+)
+
+// Config represents the configuration used to create a Kubernetes backed
+// storage.
+type Config struct {
+	// Client is the Kubernetes client used to access the API server.
+	Client kubernetes.Interface
+
+	// Namespace is the namespace the objects are stored in.
+	Namespace string
+	// Name is the base name of the objects and the value of their
+	// selecting label. Different storages must use different names.
+	Name string
+	// Secrets stores the key space in Secrets instead of ConfigMaps. Use it
+	// for sensitive data.
+	Secrets bool
+	// MaxShardSize is the maximum number of bytes of keys and values stored
+	// in a single object.
+	MaxShardSize int
+}
+
+// DefaultConfig provides a default configuration to create a new Kubernetes
+// backed storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Client: nil, // Required.
+
+		Namespace:    "", // Required.
+		Name:         "", // Required.
+		Secrets:      false,
+		MaxShardSize: DefaultMaxShardSize,
+	}
+}
+
+// New creates a new configured Kubernetes storage.
+func New(config Config) (*Storage, error) {
+	if config.Client == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Client must not be empty", config)
+	}
+	if config.Namespace == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Namespace must not be empty", config)
+	}
+	if config.Name == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Name must not be empty", config)
+	}
+	if config.MaxShardSize <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.MaxShardSize must be positive", config)
+	}
+
+	var client shardClient
+	if config.Secrets {
+		client = &secretClient{
+			client:    config.Client,
+			namespace: config.Namespace,
+			name:      config.Name,
+		}
+	} else {
+		client = &configMapClient{
+			client:    config.Client,
+			namespace: config.Namespace,
+			name:      config.Name,
+		}
+	}
+
+	storage := &Storage{
+		client: client,
+
+		name:         config.Name,
+		maxShardSize: config.MaxShardSize,
+	}
+
+	return storage, nil
+}
+
+// Storage is the Kubernetes backed storage.
+type Storage struct {
+	// Dependencies.
+
+	client shardClient
+
+	// Settings.
+
+	name         string
+	maxShardSize int
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	dataKey, err := encodeKey(kv.Key())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	size := s.client.size(dataKey, kv.Val())
+	if size > s.maxShardSize {
+		return microerror.Maskf(valueTooLargeError, "key=%s needs %d bytes but shards hold at most %d bytes", kv.Key(), size, s.maxShardSize)
+	}
+
+	err = s.retryOnConflict(kv.Key(), func() error {
+		return s.put(ctx, dataKey, kv.Val())
+	})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	dataKey, err := encodeKey(k.Key())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = s.retryOnConflict(k.Key(), func() error {
+		shards, err := s.client.list(ctx)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return s.removeFrom(ctx, holders(shards, dataKey), dataKey)
+	})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	dataKey, err := encodeKey(k.Key())
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	shards, err := s.client.list(ctx)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return len(holders(shards, dataKey)) > 0, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	key := k.Key()
+
+	shards, err := s.client.list(ctx)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	data, err := merge(shards)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	// Special case.
+	if key == "/" {
+		var list []microstorage.KV
+		for k, v := range data {
+			k = k[1:] // append a key without leading '/'.
+			list = append(list, microstorage.MustKV(microstorage.NewKV(k, v)))
+		}
+		return list, nil
+	}
+
+	var list []microstorage.KV
+
+	i := len(key)
+	for k, v := range data {
+		if len(k) <= i+1 {
+			continue
+		}
+		if !strings.HasPrefix(k, key) {
+			continue
+		}
+
+		if k[i] != '/' {
+			// We want to ignore all keys that are not separated by slash. When there
+			// is a key stored like "foo/bar/baz", listing keys using "foo/ba" should
+			// not succeed.
+			continue
+		}
+
+		k = k[i+1:]
+		list = append(list, microstorage.MustKV(microstorage.NewKV(k, v)))
+	}
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	key := k.Key()
+
+	dataKey, err := encodeKey(key)
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	shards, err := s.client.list(ctx)
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	h := holders(shards, dataKey)
+	if len(h) == 0 {
+		return microstorage.KV{}, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(key, h[len(h)-1].data[dataKey])), nil
+}
+
+func (s *Storage) put(ctx context.Context, dataKey, val string) error {
+	shards, err := s.client.list(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	h := holders(shards, dataKey)
+	size := s.client.size(dataKey, val)
+
+	// Update the value in place when it still fits into its shard.
+	if len(h) > 0 {
+		current := h[len(h)-1]
+		if s.usage(current)-s.client.size(dataKey, current.data[dataKey])+size <= s.maxShardSize {
+			current.data[dataKey] = val
+			err = s.client.update(ctx, current)
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return s.removeFrom(ctx, h[:len(h)-1], dataKey)
+		}
+	}
+
+	// Otherwise find the first shard with enough space and an index higher
+	// than the current one, or create a new shard.
+	minIndex := -1
+	if len(h) > 0 {
+		minIndex = h[len(h)-1].index
+	}
+
+	var target *shard
+	for _, sh := range shards {
+		if sh.index > minIndex && s.usage(sh)+size <= s.maxShardSize {
+			target = sh
+			break
+		}
+	}
+
+	if target != nil {
+		target.data[dataKey] = val
+		err = s.client.update(ctx, target)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	} else {
+		index := 0
+		if len(shards) > 0 {
+			index = shards[len(shards)-1].index + 1
+		}
+
+		target = &shard{
+			index: index,
+			name:  shardName(s.name, index),
+			data:  map[string]string{dataKey: val},
+		}
+		err = s.client.create(ctx, target)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return s.removeFrom(ctx, h, dataKey)
+}
+
+// removeFrom removes the key from all given shards. Shards left empty are
+// deleted.
+func (s *Storage) removeFrom(ctx context.Context, shards []*shard, dataKey string) error {
+	for _, sh := range shards {
+		delete(sh.data, dataKey)
+
+		var err error
+		if len(sh.data) == 0 {
+			err = s.client.delete(ctx, sh)
+		} else {
+			err = s.client.update(ctx, sh)
+		}
+		if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+// retryOnConflict executes f until it does not fail because of a concurrent
+// modification. After too many attempts it fails with
+// microstorage.ConflictError.
+func (s *Storage) retryOnConflict(key string, f func() error) error {
+	for i := 0; i < conflictRetries; i++ {
+		err := f()
+		if isConcurrentModification(err) {
+			continue
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+
+	return microerror.Maskf(microstorage.ConflictError, "key=%s modified concurrently %d times in a row", key, conflictRetries)
+}
+
+// usage returns the number of bytes stored in the shard.
+func (s *Storage) usage(sh *shard) int {
+	var n int
+	for k, v := range sh.data {
+		n += s.client.size(k, v)
+	}
+	return n
+}
+
+// holders returns all shards holding the key ordered by index.
+func holders(shards []*shard, dataKey string) []*shard {
+	var h []*shard
+	for _, sh := range shards {
+		if _, ok := sh.data[dataKey]; ok {
+			h = append(h, sh)
+		}
+	}
+	return h
+}
+
+// merge decodes the keys of all shards. Values from shards with higher index
+// win.
+func merge(shards []*shard) (map[string]string, error) {
+	data := map[string]string{}
+	for _, sh := range shards {
+		for k, v := range sh.data {
+			key, err := decodeKey(k)
+			if err != nil {
+				return nil, microerror.Mask(err)
+			}
+			data[key] = v
+		}
+	}
+	return data, nil
+}
+
+// isConcurrentModification tells whether the error is caused by another
+// writer modifying, creating or deleting a shard in the meantime.
+func isConcurrentModification(err error) bool {
+	return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) || apierrors.IsNotFound(err)
+}
@@ -0,0 +1,212 @@
+package kubestorage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func Test_Storage(t *testing.T) {
+	testCases := []struct {
+		name    string
+		secrets bool
+	}{
+		{
+			name:    "case 0: ConfigMaps",
+			secrets: false,
+		},
+		{
+			name:    "case 1: Secrets",
+			secrets: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Client = newFakeClient()
+			config.Namespace = "default"
+			config.Name = "microstorage"
+			config.Secrets = tc.secrets
+
+			storage, err := New(config)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			storagetest.Test(t, storage)
+		})
+	}
+}
+
+func Test_Storage_Sharding(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient()
+
+	config := DefaultConfig()
+	config.Client = client
+	config.Namespace = "default"
+	config.Name = "sharded"
+	config.MaxShardSize = 64
+
+	storage, err := New(config)
+	require.NoError(t, err)
+
+	var kvs []microstorage.KV
+	for i := 0; i < 10; i++ {
+		kv := microstorage.MustKV(microstorage.NewKV(fmt.Sprintf("shard/key-%d", i), strings.Repeat("v", 20)))
+		require.NoError(t, storage.Put(ctx, kv))
+		kvs = append(kvs, kv)
+	}
+
+	list, err := client.CoreV1().ConfigMaps("default").List(ctx, listOptions("sharded"))
+	require.NoError(t, err)
+	require.Greater(t, len(list.Items), 1)
+	for _, o := range list.Items {
+		var n int
+		for k, v := range o.Data {
+			n += len(k) + len(v)
+		}
+		require.LessOrEqual(t, n, config.MaxShardSize, "object=%s", o.Name)
+	}
+
+	// Growing a value moves it into another shard without losing it.
+	grown := microstorage.MustKV(microstorage.NewKV(kvs[0].Key(), strings.Repeat("g", 40)))
+	require.NoError(t, storage.Put(ctx, grown))
+	kvs[0] = grown
+
+	for _, kv := range kvs {
+		gotKV, err := storage.Search(ctx, kv.K())
+		require.NoError(t, err)
+		require.Equal(t, kv, gotKV)
+	}
+
+	tooLarge := microstorage.MustKV(microstorage.NewKV("shard/too-large", strings.Repeat("x", 100)))
+	err = storage.Put(ctx, tooLarge)
+	require.True(t, IsValueTooLarge(err))
+
+	// Deleting all keys removes all objects.
+	for _, kv := range kvs {
+		require.NoError(t, storage.Delete(ctx, kv.K()))
+	}
+
+	list, err = client.CoreV1().ConfigMaps("default").List(ctx, listOptions("sharded"))
+	require.NoError(t, err)
+	require.Empty(t, list.Items)
+}
+
+func Test_Storage_Conflict(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient()
+
+	config := DefaultConfig()
+	config.Client = client
+	config.Namespace = "default"
+	config.Name = "conflict"
+
+	storage, err := New(config)
+	require.NoError(t, err)
+
+	kv1 := microstorage.MustKV(microstorage.NewKV("conflict/one", "value-1"))
+	kv2 := microstorage.MustKV(microstorage.NewKV("conflict/two", "value-2"))
+
+	require.NoError(t, storage.Put(ctx, kv1))
+
+	// Simulate another writer modifying the shard right before the first
+	// update attempt. The update must be retried with fresh data instead
+	// of overwriting the concurrent change. The tracker is modified
+	// directly because the fake clientset must not be called from within
+	// a reactor.
+	var interfered bool
+	client.PrependReactor("update", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if interfered {
+			return false, nil, nil
+		}
+		interfered = true
+
+		update := action.(clienttesting.UpdateAction)
+		obj, err := client.Tracker().Get(update.GetResource(), update.GetNamespace(), shardName("conflict", 0))
+		if err != nil {
+			return true, nil, err
+		}
+		cm := obj.(*corev1.ConfigMap)
+		cm.Data["conflict.other"] = "other"
+		cm.ResourceVersion += "-modified"
+		err = client.Tracker().Update(update.GetResource(), cm, update.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+
+		return false, nil, nil
+	})
+
+	require.NoError(t, storage.Put(ctx, kv2))
+
+	for _, key := range []string{"conflict/one", "conflict/two", "conflict/other"} {
+		ok, err := storage.Exists(ctx, microstorage.MustK(microstorage.NewK(key)))
+		require.NoError(t, err)
+		require.True(t, ok, "key=%s", key)
+	}
+}
+
+// newFakeClient creates a fake clientset enforcing optimistic concurrency
+// like the API server does. The fake object tracker itself ignores
+// resourceVersion.
+func newFakeClient() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+
+	var versions int
+	nextVersion := func() string {
+		versions++
+		return strconv.Itoa(versions)
+	}
+
+	client.PrependReactor("create", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj := action.(clienttesting.CreateAction).GetObject()
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		m.SetResourceVersion(nextVersion())
+
+		return false, nil, nil
+	})
+
+	client.PrependReactor("update", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		update := action.(clienttesting.UpdateAction)
+		m, err := meta.Accessor(update.GetObject())
+		if err != nil {
+			return true, nil, err
+		}
+
+		current, err := client.Tracker().Get(update.GetResource(), update.GetNamespace(), m.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		currentMeta, err := meta.Accessor(current)
+		if err != nil {
+			return true, nil, err
+		}
+
+		if currentMeta.GetResourceVersion() != m.GetResourceVersion() {
+			return true, nil, apierrors.NewConflict(update.GetResource().GroupResource(), m.GetName(), fmt.Errorf("resourceVersion mismatch"))
+		}
+		m.SetResourceVersion(nextVersion())
+
+		return false, nil, nil
+	})
+
+	return client
+}
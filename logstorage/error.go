@@ -0,0 +1,39 @@
+package logstorage
+
+import "github.com/giantswarm/microerror"
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var corruptedRecordError = &microerror.Error{
+	Kind: "corruptedRecordError",
+}
+
+// IsCorruptedRecord asserts corruptedRecordError.
+func IsCorruptedRecord(err error) bool {
+	return microerror.Cause(err) == corruptedRecordError
+}
+
+var corruptedLogError = &microerror.Error{
+	Kind: "corruptedLogError",
+}
+
+// IsCorruptedLog asserts corruptedLogError.
+func IsCorruptedLog(err error) bool {
+	return microerror.Cause(err) == corruptedLogError
+}
+
+var failedError = &microerror.Error{
+	Kind: "failedError",
+}
+
+// IsFailed asserts failedError.
+func IsFailed(err error) bool {
+	return microerror.Cause(err) == failedError
+}
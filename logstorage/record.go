@@ -0,0 +1,139 @@
+package logstorage
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/giantswarm/microerror"
+)
+
+// Every record stored in the write-ahead log and in the snapshot has the
+// following layout. All integers are little endian.
+//
+//	+-----------+------------+-----------------+-------------------------+
+//	| crc32 (4) | length (4) | header crc32 (4)| payload (length)        |
+//	+-----------+------------+-----------------+-------------------------+
+//
+// The payload consists of the operation byte, the uvarint encoded key length,
+// the key and the value. The first checksum is CRC-32C of the payload. The
+// header checksum is CRC-32C of the first checksum and the length, so a
+// corrupted length field is not mistaken for a payload torn by a crash.
+const (
+	headerSize = 12
+
+	opPut    byte = 1
+	opDelete byte = 2
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type record struct {
+	op  byte
+	key string
+	val string
+}
+
+func (r record) encode() []byte {
+	payloadSize := 1 + binary.MaxVarintLen64 + len(r.key) + len(r.val)
+	buf := make([]byte, headerSize, headerSize+payloadSize)
+
+	buf = append(buf, r.op)
+	buf = binary.AppendUvarint(buf, uint64(len(r.key)))
+	buf = append(buf, r.key...)
+	buf = append(buf, r.val...)
+
+	payload := buf[headerSize:]
+	binary.LittleEndian.PutUint32(buf[0:4], crc32.Checksum(payload, crcTable))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[8:12], crc32.Checksum(buf[0:8], crcTable))
+
+	return buf
+}
+
+// readRecord reads a single record from r. The remaining argument is the
+// number of bytes left in the underlying file and protects from allocating
+// huge buffers for garbage length fields. It returns io.EOF when there is no
+// more data, and corruptedRecordError when the record is incomplete or it is
+// the last record and invalid, i.e. it was torn by a crash. An invalid record
+// followed by more data can not be explained by a crash, so
+// corruptedLogError is returned for it. This includes an invalid header
+// which does not end at the end of the file, because its length field can
+// not be trusted to tell where the record ends.
+func readRecord(r io.Reader, remaining int64) (record, int64, error) {
+	if remaining == 0 {
+		return record{}, 0, io.EOF
+	}
+
+	header := make([]byte, headerSize)
+	_, err := io.ReadFull(r, header)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return record{}, 0, microerror.Maskf(corruptedRecordError, "truncated header")
+	} else if err != nil {
+		return record{}, 0, microerror.Mask(err)
+	}
+
+	if crc32.Checksum(header[0:8], crcTable) != binary.LittleEndian.Uint32(header[8:12]) {
+		if remaining != headerSize {
+			return record{}, 0, microerror.Maskf(corruptedLogError, "header checksum mismatch")
+		}
+		return record{}, 0, microerror.Maskf(corruptedRecordError, "header checksum mismatch")
+	}
+
+	sum := binary.LittleEndian.Uint32(header[0:4])
+	length := int64(binary.LittleEndian.Uint32(header[4:8]))
+	if length > remaining-headerSize {
+		return record{}, 0, microerror.Maskf(corruptedRecordError, "truncated payload")
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return record{}, 0, microerror.Maskf(corruptedRecordError, "truncated payload")
+	} else if err != nil {
+		return record{}, 0, microerror.Mask(err)
+	}
+
+	last := headerSize+length == remaining
+
+	if crc32.Checksum(payload, crcTable) != sum {
+		if !last {
+			return record{}, 0, microerror.Maskf(corruptedLogError, "checksum mismatch")
+		}
+		return record{}, 0, microerror.Maskf(corruptedRecordError, "checksum mismatch")
+	}
+
+	rec, err := decodePayload(payload)
+	if IsCorruptedRecord(err) && !last {
+		return record{}, 0, microerror.Maskf(corruptedLogError, "%s", err)
+	} else if err != nil {
+		return record{}, 0, microerror.Mask(err)
+	}
+
+	return rec, headerSize + length, nil
+}
+
+func decodePayload(payload []byte) (record, error) {
+	if len(payload) < 1 {
+		return record{}, microerror.Maskf(corruptedRecordError, "empty payload")
+	}
+
+	op := payload[0]
+	if op != opPut && op != opDelete {
+		return record{}, microerror.Maskf(corruptedRecordError, "unknown operation %d", op)
+	}
+
+	keyLen, n := binary.Uvarint(payload[1:])
+	if n <= 0 || keyLen > uint64(len(payload)-1-n) {
+		return record{}, microerror.Maskf(corruptedRecordError, "invalid key length")
+	}
+
+	rest := payload[1+n:]
+	rec := record{
+		op:  op,
+		key: string(rest[:keyLen]),
+		val: string(rest[keyLen:]),
+	}
+
+	return rec, nil
+}
@@ -0,0 +1,493 @@
+// Package logstorage provides an embedded storage implementation persisting
+// all operations to an append-only write-ahead log.
+//
+// The whole key space is kept in an in-memory index which is rebuilt from the
+// snapshot file and the write-ahead log when the storage is opened. Every
+// record is protected by a checksum. A record torn by a crash at the end of
+// the log is detected and truncated on open. Invalid records followed by
+// valid ones can not be caused by a crash, so opening fails with an error
+// matched by IsCorruptedLog instead of dropping data. Compaction writes the
+// current index into a new snapshot and empties the log.
+//
+// A write failing to be appended or flushed is removed from the log again,
+// so it is not replayed on the next open. When that fails as well, the log
+// can not be trusted anymore and all further writes fail with an error
+// matched by IsFailed until the storage is reopened.
+package logstorage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+const (
+	walFileName      = "wal"
+	snapshotFileName = "snapshot"
+	dirPermissions   = 0700
+	filePermissions  = 0600
+)
+
+// Config represents the configuration used to create a log backed storage.
+type Config struct {
+	// Dir is the directory holding the write-ahead log and the snapshot. It
+	// is created when it does not exist.
+	Dir string
+	// CompactionInterval is the interval of periodic compaction. Zero
+	// disables periodic compaction. Compact can be called explicitly at any
+	// time.
+	CompactionInterval time.Duration
+	// NoSync disables flushing the write-ahead log to disk after every
+	// write. This trades durability of the most recent writes for speed.
+	NoSync bool
+}
+
+// DefaultConfig provides a default configuration to create a new log backed
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Dir:                "", // Required.
+		CompactionInterval: 10 * time.Minute,
+		NoSync:             false,
+	}
+}
+
+// New opens the log backed storage in the configured directory, rebuilding
+// the index from the snapshot and the write-ahead log. The returned Storage
+// must be closed with Close.
+func New(config Config) (*Storage, error) {
+	if config.Dir == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Dir must not be empty", config)
+	}
+	if config.CompactionInterval < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.CompactionInterval must not be negative", config)
+	}
+
+	err := os.MkdirAll(config.Dir, dirPermissions)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	s := &Storage{
+		dir:    config.Dir,
+		noSync: config.NoSync,
+
+		data:  map[string]string{},
+		mutex: sync.Mutex{},
+		done:  make(chan struct{}),
+	}
+
+	err = s.loadSnapshot()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	err = s.openWAL()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	if config.CompactionInterval > 0 {
+		s.wg.Add(1)
+		go s.compactLoop(config.CompactionInterval)
+	}
+
+	return s, nil
+}
+
+// Storage is the log backed storage.
+type Storage struct {
+	// Settings.
+
+	dir    string
+	noSync bool
+
+	// Internals.
+
+	data  map[string]string
+	mutex sync.Mutex
+	wal   logFile
+	// failed is the error which left the log in an unknown state. Writes
+	// are rejected once it is set.
+	failed error
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := s.append(record{op: opPut, key: kv.Key(), val: kv.Val()})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	s.data[kv.Key()] = kv.Val()
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	key := k.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.data[key]; !ok {
+		return nil
+	}
+
+	err := s.append(record{op: opDelete, key: key})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	delete(s.data, key)
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	key := k.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.data[key]
+
+	return ok, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	key := k.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Special case.
+	if key == "/" {
+		var list []microstorage.KV
+		for k, v := range s.data {
+			k = k[1:] // append a key without leading '/'.
+			list = append(list, microstorage.MustKV(microstorage.NewKV(k, v)))
+		}
+		return list, nil
+	}
+
+	var list []microstorage.KV
+
+	i := len(key)
+	for k, v := range s.data {
+		if len(k) <= i+1 {
+			continue
+		}
+		if !strings.HasPrefix(k, key) {
+			continue
+		}
+
+		if k[i] != '/' {
+			// We want to ignore all keys that are not separated by slash. When there
+			// is a key stored like "foo/bar/baz", listing keys using "foo/ba" should
+			// not succeed.
+			continue
+		}
+
+		k = k[i+1:]
+		list = append(list, microstorage.MustKV(microstorage.NewKV(k, v)))
+	}
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	key := k.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value, ok := s.data[key]
+	if ok {
+		return microstorage.MustKV(microstorage.NewKV(key, value)), nil
+	}
+
+	return microstorage.KV{}, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+}
+
+// Compact writes the current state into a new snapshot and empties the
+// write-ahead log. The snapshot is replaced atomically. When the process
+// crashes after the snapshot is replaced but before the log is emptied,
+// replaying the log on the next open yields the same state. Compact does
+// nothing when the log is empty, i.e. nothing changed since the last
+// compaction.
+func (s *Storage) Compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	size, err := s.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	if size == 0 {
+		return nil
+	}
+
+	snapshot := filepath.Join(s.dir, snapshotFileName)
+
+	f, err := os.CreateTemp(s.dir, snapshotFileName+".tmp-*")
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(f)
+	for k, v := range s.data {
+		_, err = w.Write(record{op: opPut, key: k, val: v}.encode())
+		if err != nil {
+			f.Close()
+			return microerror.Mask(err)
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+	err = f.Close()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = os.Rename(tmp, snapshot)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = syncDir(s.dir)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = s.wal.Truncate(0)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	_, err = s.wal.Seek(0, io.SeekStart)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	err = s.wal.Sync()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// Close stops periodic compaction and closes the write-ahead log. The Storage
+// must not be used after Close.
+func (s *Storage) Close() error {
+	var err error
+
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		err = s.wal.Close()
+	})
+
+	return microerror.Mask(err)
+}
+
+// logFile is the write-ahead log file. It is satisfied by *os.File.
+type logFile interface {
+	io.WriteSeeker
+	io.Closer
+
+	Sync() error
+	Truncate(size int64) error
+}
+
+// append writes the record to the write-ahead log. It must be called with
+// s.mutex held.
+func (s *Storage) append(rec record) error {
+	if s.failed != nil {
+		return microerror.Maskf(failedError, "%s", s.failed)
+	}
+
+	offset, err := s.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	_, err = s.wal.Write(rec.encode())
+	if err == nil && !s.noSync {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		// Drop the record. A write reported as failed must not be
+		// replayed on the next open, and all records appended after a
+		// partially written one would be lost when the log is replayed.
+		s.rollback(offset)
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// rollback truncates the write-ahead log to offset. When this fails the
+// storage is marked as failed. It must be called with s.mutex held.
+func (s *Storage) rollback(offset int64) {
+	err := s.wal.Truncate(offset)
+	if err == nil {
+		_, err = s.wal.Seek(offset, io.SeekStart)
+	}
+	if err == nil && !s.noSync {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		s.failed = err
+	}
+}
+
+func (s *Storage) compactLoop(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			// Errors are not fatal here. The log keeps all the data
+			// and compaction is retried on the next tick.
+			_ = s.Compact()
+		}
+	}
+}
+
+// loadSnapshot reads the snapshot into the index. The snapshot is always
+// replaced atomically, so unlike the write-ahead log it must never contain
+// a corrupted record.
+func (s *Storage) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+	defer f.Close()
+
+	_, err = s.replay(f)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// openWAL replays the write-ahead log into the index and opens it for
+// appending. A corrupted or incomplete last record is truncated. Corrupted
+// records followed by more data fail with corruptedLogError.
+func (s *Storage) openWAL() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, walFileName), os.O_RDWR|os.O_CREATE, filePermissions)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	offset, err := s.replay(f)
+	if IsCorruptedRecord(err) {
+		err = f.Truncate(offset)
+		if err != nil {
+			f.Close()
+			return microerror.Mask(err)
+		}
+		err = f.Sync()
+		if err != nil {
+			f.Close()
+			return microerror.Mask(err)
+		}
+	} else if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return microerror.Mask(err)
+	}
+
+	s.wal = f
+
+	return nil
+}
+
+// replay applies all records read from f to the index. It returns the offset
+// right after the last valid record.
+func (s *Storage) replay(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, microerror.Mask(err)
+	}
+
+	r := bufio.NewReader(f)
+	size := info.Size()
+
+	var offset int64
+	for {
+		rec, n, err := readRecord(r, size-offset)
+		if err == io.EOF {
+			return offset, nil
+		} else if err != nil {
+			return offset, microerror.Mask(err)
+		}
+
+		switch rec.op {
+		case opPut:
+			s.data[rec.key] = rec.val
+		case opDelete:
+			delete(s.data, rec.key)
+		}
+
+		offset += n
+	}
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer d.Close()
+
+	err = d.Sync()
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package logstorage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func Test_Storage(t *testing.T) {
+	storage := newTestStorage(t, t.TempDir())
+	storagetest.Test(t, storage)
+}
+
+func Test_Storage_Reopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	kv1 := microstorage.MustKV(microstorage.NewKV("reopen/one", "value-1"))
+	kv2 := microstorage.MustKV(microstorage.NewKV("reopen/two", "value-2"))
+
+	storage := newTestStorage(t, dir)
+	require.NoError(t, storage.Put(ctx, kv1))
+	require.NoError(t, storage.Put(ctx, kv2))
+	require.NoError(t, storage.Delete(ctx, kv1.K()))
+	require.NoError(t, storage.Close())
+
+	storage = newTestStorage(t, dir)
+
+	ok, err := storage.Exists(ctx, kv1.K())
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	gotKV, err := storage.Search(ctx, kv2.K())
+	require.NoError(t, err)
+	require.Equal(t, kv2, gotKV)
+}
+
+func Test_Storage_Compact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	kv1 := microstorage.MustKV(microstorage.NewKV("compact/one", "value-1"))
+	kv2 := microstorage.MustKV(microstorage.NewKV("compact/two", "value-2"))
+	kv3 := microstorage.MustKV(microstorage.NewKV("compact/three", "value-3"))
+
+	storage := newTestStorage(t, dir)
+	require.NoError(t, storage.Put(ctx, kv1))
+	require.NoError(t, storage.Put(ctx, kv2))
+	require.NoError(t, storage.Delete(ctx, kv1.K()))
+	require.NoError(t, storage.Compact())
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+
+	// Compacting again without changes keeps the snapshot.
+	before, err := os.Stat(filepath.Join(dir, snapshotFileName))
+	require.NoError(t, err)
+	require.NoError(t, storage.Compact())
+	after, err := os.Stat(filepath.Join(dir, snapshotFileName))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(before, after))
+
+	// Writes after compaction land in the emptied log.
+	require.NoError(t, storage.Put(ctx, kv3))
+	require.NoError(t, storage.Close())
+
+	storage = newTestStorage(t, dir)
+
+	list, err := storage.List(ctx, microstorage.MustK(microstorage.NewK("compact")))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []microstorage.KV{
+		microstorage.MustKV(microstorage.NewKV("two", "value-2")),
+		microstorage.MustKV(microstorage.NewKV("three", "value-3")),
+	}, list)
+}
+
+func Test_Storage_RecoverTail(t *testing.T) {
+	testCases := []struct {
+		name    string
+		corrupt func(t *testing.T, p string)
+	}{
+		{
+			name: "case 0: truncated tail",
+			corrupt: func(t *testing.T, p string) {
+				info, err := os.Stat(p)
+				require.NoError(t, err)
+				require.NoError(t, os.Truncate(p, info.Size()-3))
+			},
+		},
+		{
+			name: "case 1: flipped byte in tail",
+			corrupt: func(t *testing.T, p string) {
+				b, err := os.ReadFile(p)
+				require.NoError(t, err)
+				b[len(b)-1] ^= 0xff
+				require.NoError(t, os.WriteFile(p, b, filePermissions))
+			},
+		},
+		{
+			name: "case 2: truncated payload",
+			corrupt: func(t *testing.T, p string) {
+				rec := record{op: opPut, key: "/recover/torn", val: "value"}.encode()
+				f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND, filePermissions)
+				require.NoError(t, err)
+				_, err = f.Write(rec[:len(rec)-2])
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			},
+		},
+		{
+			name: "case 3: garbage header",
+			corrupt: func(t *testing.T, p string) {
+				f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND, filePermissions)
+				require.NoError(t, err)
+				_, err = f.Write([]byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0x7f, 0, 0, 0, 0})
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+
+			kv1 := microstorage.MustKV(microstorage.NewKV("recover/one", "value-1"))
+			kv2 := microstorage.MustKV(microstorage.NewKV("recover/two", "value-2"))
+			kv3 := microstorage.MustKV(microstorage.NewKV("recover/three", "value-3"))
+
+			storage := newTestStorage(t, dir)
+			require.NoError(t, storage.Put(ctx, kv1))
+			require.NoError(t, storage.Put(ctx, kv2))
+			require.NoError(t, storage.Close())
+
+			tc.corrupt(t, filepath.Join(dir, walFileName))
+
+			storage = newTestStorage(t, dir)
+
+			gotKV, err := storage.Search(ctx, kv1.K())
+			require.NoError(t, err)
+			require.Equal(t, kv1, gotKV)
+
+			// The storage must stay writable after recovery and
+			// the new records must survive another reopen.
+			require.NoError(t, storage.Put(ctx, kv3))
+			require.NoError(t, storage.Close())
+
+			storage = newTestStorage(t, dir)
+
+			gotKV, err = storage.Search(ctx, kv3.K())
+			require.NoError(t, err)
+			require.Equal(t, kv3, gotKV)
+		})
+	}
+}
+
+func Test_Storage_CorruptedLog(t *testing.T) {
+	kv1 := microstorage.MustKV(microstorage.NewKV("corrupted/one", "value-1"))
+	kv2 := microstorage.MustKV(microstorage.NewKV("corrupted/two", "value-2"))
+
+	// The second record is still valid after corrupting the first one, so
+	// this is no torn tail.
+	testCases := []struct {
+		name   string
+		offset int
+	}{
+		{
+			name:   "case 0: flipped byte in payload",
+			offset: len(record{op: opPut, key: kv1.Key(), val: kv1.Val()}.encode()) - 1,
+		},
+		{
+			name:   "case 1: flipped byte in length field",
+			offset: 7,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+
+			storage := newTestStorage(t, dir)
+			require.NoError(t, storage.Put(ctx, kv1))
+			require.NoError(t, storage.Put(ctx, kv2))
+			require.NoError(t, storage.Close())
+
+			p := filepath.Join(dir, walFileName)
+			b, err := os.ReadFile(p)
+			require.NoError(t, err)
+			b[tc.offset] ^= 0x01
+			require.NoError(t, os.WriteFile(p, b, filePermissions))
+
+			config := DefaultConfig()
+			config.Dir = dir
+			config.CompactionInterval = 0
+
+			_, err = New(config)
+			require.True(t, IsCorruptedLog(err), "expected corruptedLogError, got %#v", err)
+
+			// The log is left alone, so no valid record is lost.
+			info, err := os.Stat(p)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(b)), info.Size())
+		})
+	}
+}
+
+func newTestStorage(t *testing.T, dir string) *Storage {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.Dir = dir
+	config.CompactionInterval = 0
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	t.Cleanup(func() { _ = storage.Close() })
+
+	return storage
+}
+
+// failingFile fails Sync and optionally Truncate of the underlying file.
+type failingFile struct {
+	*os.File
+
+	failTruncate bool
+}
+
+func (f *failingFile) Sync() error {
+	return errors.New("sync failed")
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("truncate failed")
+	}
+
+	return f.File.Truncate(size)
+}
+
+func Test_Storage_SyncFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	kv1 := microstorage.MustKV(microstorage.NewKV("sync/one", "value-1"))
+	kv2 := microstorage.MustKV(microstorage.NewKV("sync/two", "value-2"))
+	kv3 := microstorage.MustKV(microstorage.NewKV("sync/three", "value-3"))
+
+	storage := newTestStorage(t, dir)
+	require.NoError(t, storage.Put(ctx, kv1))
+
+	// The failed write is rolled back, so it is neither visible nor
+	// replayed later.
+	wal := storage.wal
+	storage.wal = &failingFile{File: wal.(*os.File)}
+	require.Error(t, storage.Put(ctx, kv2))
+
+	_, err := storage.Search(ctx, kv2.K())
+	require.True(t, microstorage.IsNotFound(err), "expected NotFoundError, got %#v", err)
+
+	// When the rollback fails as well, all further writes are rejected.
+	storage.wal = &failingFile{File: wal.(*os.File), failTruncate: true}
+	require.Error(t, storage.Put(ctx, kv2))
+
+	storage.wal = wal
+	err = storage.Put(ctx, kv3)
+	require.True(t, IsFailed(err), "expected failedError, got %#v", err)
+	require.NoError(t, storage.Close())
+
+	storage = newTestStorage(t, dir)
+
+	gotKV, err := storage.Search(ctx, kv1.K())
+	require.NoError(t, err)
+	require.Equal(t, kv1, gotKV)
+
+	_, err = storage.Search(ctx, kv3.K())
+	require.True(t, microstorage.IsNotFound(err), "expected NotFoundError, got %#v", err)
+	require.NoError(t, storage.Put(ctx, kv3))
+}
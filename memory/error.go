@@ -0,0 +1,21 @@
+package memory
+
+import "github.com/giantswarm/microerror"
+
+var invalidTTLError = &microerror.Error{
+	Kind: "invalidTTLError",
+}
+
+// IsInvalidTTL asserts invalidTTLError.
+func IsInvalidTTL(err error) bool {
+	return microerror.Cause(err) == invalidTTLError
+}
+
+var invalidLimitError = &microerror.Error{
+	Kind: "invalidLimitError",
+}
+
+// IsInvalidLimit asserts invalidLimitError.
+func IsInvalidLimit(err error) bool {
+	return microerror.Cause(err) == invalidLimitError
+}
@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"container/heap"
+	"time"
+)
+
+// deadline is the expiration time of a value stored with PutWithTTL.
+type deadline struct {
+	key string
+	t   time.Time
+}
+
+// deadlines is a min-heap of deadlines ordered by expiration time. Deadlines
+// of values overwritten or deleted in the meantime are not removed from the
+// heap. They are skipped when popped, see Storage.expire.
+type deadlines []deadline
+
+func (d deadlines) Len() int           { return len(d) }
+func (d deadlines) Less(i, j int) bool { return d[i].t.Before(d[j].t) }
+func (d deadlines) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+func (d *deadlines) Push(x interface{}) {
+	*d = append(*d, x.(deadline))
+}
+
+func (d *deadlines) Pop() interface{} {
+	old := *d
+	n := len(old)
+	x := old[n-1]
+	*d = old[:n-1]
+	return x
+}
+
+// expireAt sets the expiration time of the value stored under key. It must
+// be called with s.mutex held.
+func (s *Storage) expireAt(key string, t time.Time) {
+	s.expiring[key] = t
+	heap.Push(&s.deadlines, deadline{key: key, t: t})
+
+	s.schedule()
+}
+
+// expire removes all values which TTL has elapsed. It must be called with
+// s.mutex held.
+func (s *Storage) expire() {
+	if len(s.deadlines) == 0 {
+		return
+	}
+
+	now := s.clock()
+	for len(s.deadlines) > 0 && !now.Before(s.deadlines[0].t) {
+		d := heap.Pop(&s.deadlines).(deadline)
+
+		// The value was overwritten or deleted after the deadline was
+		// pushed.
+		t, ok := s.expiring[d.key]
+		if !ok || !t.Equal(d.t) {
+			continue
+		}
+
+		s.delete(d.key)
+	}
+
+	s.schedule()
+}
+
+// schedule arms the timer for the earliest deadline, so expired values are
+// removed and watchers are notified even when no other operation is called.
+// It must be called with s.mutex held.
+func (s *Storage) schedule() {
+	if len(s.deadlines) == 0 {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		s.timerAt = time.Time{}
+		return
+	}
+
+	next := s.deadlines[0].t
+	if next.Equal(s.timerAt) {
+		return
+	}
+	s.timerAt = next
+
+	d := next.Sub(s.clock())
+	if s.timer == nil {
+		s.timer = time.AfterFunc(d, s.expireOnTimer)
+	} else {
+		s.timer.Reset(d)
+	}
+}
+
+func (s *Storage) expireOnTimer() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The timer fired, so it needs to be armed again even when the
+	// earliest deadline did not change, e.g. because Config.Clock is not
+	// driven by the wall clock.
+	s.timerAt = time.Time{}
+	s.expire()
+}
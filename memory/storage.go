@@ -2,9 +2,12 @@
 package memory
 
 import (
+	"bytes"
 	"context"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/giantswarm/microerror"
 
@@ -13,19 +16,34 @@ import (
 
 // Config represents the configuration used to create a memory backed storage.
 type Config struct {
+	// Clock returns the current time. It is used to expire values stored
+	// with PutWithTTL and may be replaced in tests to control time
+	// deterministically. Defaults to time.Now.
+	Clock func() time.Time
 }
 
 // DefaultConfig provides a default configuration to create a new memory backed
 // storage by best effort.
 func DefaultConfig() Config {
-	return Config{}
+	return Config{
+		Clock: time.Now,
+	}
 }
 
 // New creates a new configured memory storage.
 func New(config Config) (*Storage, error) {
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+
 	storage := &Storage{
-		data:  map[string]string{},
+		clock: config.Clock,
+
+		data:  map[string]entry{},
 		mutex: sync.Mutex{},
+
+		expiring: map[string]time.Time{},
+		watchers: map[*watcher]struct{}{},
 	}
 
 	return storage, nil
@@ -33,17 +51,70 @@ func New(config Config) (*Storage, error) {
 
 // Storage is the memory backed storage.
 type Storage struct {
+	// Dependencies.
+
+	clock func() time.Time
+
 	// Internals.
 
-	data  map[string]string
-	mutex sync.Mutex
+	data     map[string]entry
+	mutex    sync.Mutex
+	revision int64
+
+	// expiring tracks expiration times of values stored with PutWithTTL.
+	// Expired values are removed by a timer armed for the earliest
+	// deadline and at the beginning of every operation, so operations
+	// never see expired values even when Config.Clock is not driven by the
+	// wall clock.
+	expiring  map[string]time.Time
+	deadlines deadlines
+	timer     *time.Timer
+	timerAt   time.Time
+
+	watchers map[*watcher]struct{}
+}
+
+// entry is a stored value. Values are stored as byte slices, so PutBytes and
+// SearchBytes only copy them once, like Put and Search.
+type entry struct {
+	val []byte
+	rev int64
 }
 
 func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.data[kv.Key()] = kv.Val()
+	s.expire()
+
+	s.put(kv.Key(), []byte(kv.Val()))
+
+	return nil
+}
+
+func (s *Storage) PutBytes(ctx context.Context, k microstorage.K, val []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+
+	s.put(k.Key(), bytes.Clone(val))
+
+	return nil
+}
+
+func (s *Storage) PutWithTTL(ctx context.Context, kv microstorage.KV, ttl time.Duration) error {
+	if ttl <= 0 {
+		return microerror.Maskf(invalidTTLError, "ttl must be positive, got %s", ttl)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+
+	s.put(kv.Key(), []byte(kv.Val()))
+	s.expireAt(kv.Key(), s.clock().Add(ttl))
 
 	return nil
 }
@@ -54,7 +125,9 @@ func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	delete(s.data, key)
+	s.expire()
+
+	s.delete(key)
 
 	return nil
 }
@@ -65,6 +138,8 @@ func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	s.expire()
+
 	_, ok := s.data[key]
 
 	return ok, nil
@@ -76,12 +151,14 @@ func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	s.expire()
+
 	// Special case.
 	if key == "/" {
 		var list []microstorage.KV
-		for k, v := range s.data {
+		for k, e := range s.data {
 			k = k[1:] // append a key without leading '/'.
-			list = append(list, microstorage.MustKV(microstorage.NewKV(k, v)))
+			list = append(list, microstorage.MustKV(microstorage.NewKV(k, string(e.val))))
 		}
 		return list, nil
 	}
@@ -89,7 +166,7 @@ func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV
 	var list []microstorage.KV
 
 	i := len(key)
-	for k, v := range s.data {
+	for k, e := range s.data {
 		if len(k) <= i+1 {
 			continue
 		}
@@ -105,22 +182,218 @@ func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV
 		}
 
 		k = k[i+1:]
-		list = append(list, microstorage.MustKV(microstorage.NewKV(k, v)))
+		list = append(list, microstorage.MustKV(microstorage.NewKV(k, string(e.val))))
+	}
+
+	return list, nil
+}
+
+func (s *Storage) ListPage(ctx context.Context, k microstorage.K, after string, limit int) ([]microstorage.KV, error) {
+	if limit <= 0 {
+		return nil, microerror.Maskf(invalidLimitError, "limit must be positive, got %d", limit)
+	}
+
+	key := k.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+
+	// Relative keys sort like the full keys they are part of, so the full
+	// keys are sorted and only the page is turned into KVs.
+	var keys []string
+	for k := range s.data {
+		rel, ok := relativeKey(key, k)
+		if !ok || rel <= after {
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	list := make([]microstorage.KV, 0, len(keys))
+	for _, k := range keys {
+		rel, _ := relativeKey(key, k)
+		list = append(list, microstorage.MustKV(microstorage.NewKV(rel, string(s.data[k].val))))
 	}
 
 	return list, nil
 }
 
 func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	kv, _, err := s.SearchWithRevision(ctx, k)
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	return kv, nil
+}
+
+func (s *Storage) SearchBytes(ctx context.Context, k microstorage.K) ([]byte, error) {
+	key := k.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+
+	e, ok := s.data[key]
+	if ok {
+		return bytes.Clone(e.val), nil
+	}
+
+	return nil, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+}
+
+func (s *Storage) SearchWithRevision(ctx context.Context, k microstorage.K) (microstorage.KV, int64, error) {
 	key := k.Key()
 
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	value, ok := s.data[key]
+	s.expire()
+
+	e, ok := s.data[key]
 	if ok {
-		return microstorage.MustKV(microstorage.NewKV(key, value)), nil
+		return microstorage.MustKV(microstorage.NewKV(key, string(e.val))), e.rev, nil
+	}
+
+	return microstorage.KV{}, 0, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+}
+
+func (s *Storage) PutIfRevision(ctx context.Context, kv microstorage.KV, rev int64) (int64, error) {
+	key := kv.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+
+	e, ok := s.data[key]
+	if !ok || e.rev != rev {
+		return 0, microerror.Maskf(microstorage.ConflictError, "key=%s expected revision=%d", key, rev)
+	}
+
+	return s.put(key, []byte(kv.Val())), nil
+}
+
+func (s *Storage) PutIfAbsent(ctx context.Context, kv microstorage.KV) (int64, error) {
+	key := kv.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+
+	if _, ok := s.data[key]; ok {
+		return 0, microerror.Maskf(microstorage.ConflictError, "key=%s already exists", key)
+	}
+
+	return s.put(key, []byte(kv.Val())), nil
+}
+
+func (s *Storage) DeleteIfRevision(ctx context.Context, k microstorage.K, rev int64) error {
+	key := k.Key()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+
+	e, ok := s.data[key]
+	if !ok || e.rev != rev {
+		return microerror.Maskf(microstorage.ConflictError, "key=%s expected revision=%d", key, rev)
+	}
+
+	s.delete(key)
+
+	return nil
+}
+
+func (s *Storage) Txn(ctx context.Context, txn *microstorage.Txn) (microstorage.TxnResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+
+	succeeded := true
+	for _, c := range txn.Conditions() {
+		e, ok := s.data[c.K().Key()]
+		if !c.Eval(ok, string(e.val), e.rev) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := txn.ThenOps()
+	if !succeeded {
+		ops = txn.ElseOps()
+	}
+
+	// Validate all operations upfront so nothing is applied when any of them
+	// is malformed, e.g. created as zero value instead of using NewOp*.
+	for _, o := range ops {
+		if o.K().Key() == "" {
+			return microstorage.TxnResponse{}, microerror.Maskf(microstorage.InvalidKeyError, "empty key in transaction operation")
+		}
+	}
+
+	for _, o := range ops {
+		switch o.Type() {
+		case microstorage.OpPut:
+			s.put(o.KV().Key(), []byte(o.KV().Val()))
+		case microstorage.OpDelete:
+			s.delete(o.K().Key())
+		}
+	}
+
+	res := microstorage.TxnResponse{
+		Succeeded: succeeded,
+	}
+
+	return res, nil
+}
+
+// put stores the value and returns its new revision. The storage takes
+// ownership of val. It must be called with s.mutex held.
+func (s *Storage) put(key string, val []byte) int64 {
+	s.revision++
+	s.data[key] = entry{val: val, rev: s.revision}
+	delete(s.expiring, key)
+	s.emit(microstorage.EventPut, key, val)
+
+	return s.revision
+}
+
+// delete removes the value if it exists. It must be called with s.mutex held.
+func (s *Storage) delete(key string) {
+	if _, ok := s.data[key]; !ok {
+		return
+	}
+
+	s.revision++
+	delete(s.data, key)
+	delete(s.expiring, key)
+	s.emit(microstorage.EventDelete, key, nil)
+}
+
+// relativeKey returns the key relative to the listed key with a leading
+// slash, i.e. the key of the KV returned by List, and whether key is nested
+// below the listed key at all.
+func relativeKey(listed, key string) (string, bool) {
+	if listed == "/" {
+		return key, true
+	}
+
+	// Same as in List, keys not separated by slash are ignored.
+	if len(key) <= len(listed)+1 || !strings.HasPrefix(key, listed) || key[len(listed)] != '/' {
+		return "", false
 	}
 
-	return microstorage.KV{}, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+	return key[len(listed):], true
 }
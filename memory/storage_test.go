@@ -1,8 +1,11 @@
 package memory
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/giantswarm/microstorage"
 	"github.com/giantswarm/microstorage/storagetest"
 )
 
@@ -13,3 +16,74 @@ func Test_Storage(t *testing.T) {
 	}
 	storagetest.Test(t, storage)
 }
+
+func Test_Storage_TTL(t *testing.T) {
+	clock := storagetest.NewClock()
+
+	config := DefaultConfig()
+	config.Clock = clock.Now
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	storagetest.TestTTL(t, storage, clock)
+}
+
+func Test_Storage_TTLWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storage, err := New(DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	k := microstorage.MustK(microstorage.NewK("leader"))
+	events, err := storage.Watch(ctx, k)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// The overwritten deadline must not expire the renewed value.
+	err = storage.PutWithTTL(ctx, microstorage.MustKV(microstorage.NewKV("leader", "a")), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = storage.PutWithTTL(ctx, microstorage.MustKV(microstorage.NewKV("leader", "b")), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	start := time.Now()
+
+	// No other operation is called, the watcher must still be notified
+	// about the expired value.
+	var types []microstorage.EventType
+	for len(types) < 3 {
+		select {
+		case e := <-events:
+			types = append(types, e.Type)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected", "expiry event", "got", "timeout")
+		}
+	}
+
+	expected := []microstorage.EventType{microstorage.EventPut, microstorage.EventPut, microstorage.EventDelete}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatal("expected", expected, "got", types)
+		}
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatal("expected", "expiry after 100ms", "got", d)
+	}
+
+	exists, err := storage.Exists(ctx, k)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if exists {
+		t.Fatal("expected", false, "got", exists)
+	}
+}
@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// watcher delivers events for a single Watch call. Events are queued without
+// blocking the storage and forwarded to the consumer by a dedicated goroutine,
+// so slow consumers never stall writers.
+type watcher struct {
+	key string
+
+	mutex  sync.Mutex
+	queue  []microstorage.Event
+	notify chan struct{}
+}
+
+func (s *Storage) Watch(ctx context.Context, k microstorage.K) (<-chan microstorage.Event, error) {
+	w := &watcher{
+		key:    k.Key(),
+		notify: make(chan struct{}, 1),
+	}
+
+	s.mutex.Lock()
+	s.watchers[w] = struct{}{}
+	s.mutex.Unlock()
+
+	ch := make(chan microstorage.Event)
+
+	go func() {
+		defer close(ch)
+		defer func() {
+			s.mutex.Lock()
+			delete(s.watchers, w)
+			s.mutex.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.notify:
+			}
+
+			w.mutex.Lock()
+			events := w.queue
+			w.queue = nil
+			w.mutex.Unlock()
+
+			for _, e := range events {
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- e:
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// emit queues the event for all watchers interested in the key. It must be
+// called with s.mutex held.
+func (s *Storage) emit(t microstorage.EventType, key string, val []byte) {
+	if len(s.watchers) == 0 {
+		return
+	}
+
+	e := microstorage.Event{
+		Type: t,
+		KV:   microstorage.MustKV(microstorage.NewKV(key, string(val))),
+	}
+
+	for w := range s.watchers {
+		if !w.matches(key) {
+			continue
+		}
+
+		w.mutex.Lock()
+		w.queue = append(w.queue, e)
+		w.mutex.Unlock()
+
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *watcher) matches(key string) bool {
+	if w.key == "/" || w.key == key {
+		return true
+	}
+
+	// Same as in List, keys not separated by slash are ignored. Watching
+	// "/foo/ba" must not report changes of "/foo/bar/baz".
+	return strings.HasPrefix(key, w.key) && key[len(w.key)] == '/'
+}
@@ -2,11 +2,13 @@ package metricsstorage
 
 import (
 	"context"
+	"time"
 
 	"github.com/giantswarm/microerror"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/internal/metrics"
 )
 
 const (
@@ -17,55 +19,46 @@ const (
 	existsActionName = "exists"
 	listActionName   = "list"
 	searchActionName = "search"
-)
-
-var (
-	actionTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: prometheusNamespace,
-			Name:      "action_total",
-			Help:      "Total number of storage actions performed.",
-		},
-		[]string{"action"},
-	)
+	watchActionName  = "watch"
 
-	errorTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Namespace: prometheusNamespace,
-			Name:      "error_total",
-			Help:      "Total number of storage actions that have errored.",
-		},
-		[]string{"action"},
-	)
-
-	actionDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: prometheusNamespace,
-			Name:      "action_duration_seconds",
-			Help:      "Duration of time to perform storage actions.",
-		},
-		[]string{"action"},
-	)
+	// Values of the outcome label.
+	successOutcome  = "success"
+	notFoundOutcome = "not_found"
+	errorOutcome    = "error"
 )
 
-func init() {
-	prometheus.MustRegister(actionTotal)
-	prometheus.MustRegister(errorTotal)
-	prometheus.MustRegister(actionDuration)
-}
-
 type Config struct {
 	Underlying microstorage.Storage
+
+	// Registerer the collectors are registered with. It defaults to
+	// prometheus.DefaultRegisterer. When collectors with the same
+	// namespace and constant labels are registered already, they are
+	// shared.
+	Registerer prometheus.Registerer
+	// Namespace of all metric names. It defaults to "microstorage".
+	Namespace string
+	// ConstLabels are added to all metrics, e.g. the name of the backend.
+	// They distinguish multiple instrumented storages registered with the
+	// same Registerer.
+	ConstLabels prometheus.Labels
 }
 
 func DefaultConfig() Config {
 	return Config{
 		Underlying: nil,
+
+		Registerer:  prometheus.DefaultRegisterer,
+		Namespace:   prometheusNamespace,
+		ConstLabels: nil,
 	}
 }
 
 type Storage struct {
 	underlying microstorage.Storage
+
+	actionTotal    *prometheus.CounterVec
+	errorTotal     *prometheus.CounterVec
+	actionDuration *prometheus.HistogramVec
 }
 
 func New(config Config) (*Storage, error) {
@@ -73,84 +66,159 @@ func New(config Config) (*Storage, error) {
 		return nil, microerror.Maskf(invalidConfigError, "config.Underlying must not be empty")
 	}
 
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	if config.Namespace == "" {
+		config.Namespace = prometheusNamespace
+	}
+
+	actionTotal := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   config.Namespace,
+			Name:        "action_total",
+			Help:        "Total number of storage actions performed.",
+			ConstLabels: config.ConstLabels,
+		},
+		[]string{"action", "outcome"},
+	)
+	c, err := metrics.Register(config.Registerer, actionTotal)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	actionTotal, ok := c.(*prometheus.CounterVec)
+	if !ok {
+		return nil, microerror.Maskf(invalidConfigError, "collector action_total registered already with a different type")
+	}
+
+	errorTotal := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   config.Namespace,
+			Name:        "error_total",
+			Help:        "Total number of storage actions that have errored. Values not found are not counted.",
+			ConstLabels: config.ConstLabels,
+		},
+		[]string{"action"},
+	)
+	c, err = metrics.Register(config.Registerer, errorTotal)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	errorTotal, ok = c.(*prometheus.CounterVec)
+	if !ok {
+		return nil, microerror.Maskf(invalidConfigError, "collector error_total registered already with a different type")
+	}
+
+	actionDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   config.Namespace,
+			Name:        "action_duration_seconds",
+			Help:        "Duration of time to perform storage actions.",
+			ConstLabels: config.ConstLabels,
+		},
+		[]string{"action"},
+	)
+	c, err = metrics.Register(config.Registerer, actionDuration)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	actionDuration, ok = c.(*prometheus.HistogramVec)
+	if !ok {
+		return nil, microerror.Maskf(invalidConfigError, "collector action_duration_seconds registered already with a different type")
+	}
+
 	s := &Storage{
 		underlying: config.Underlying,
+
+		actionTotal:    actionTotal,
+		errorTotal:     errorTotal,
+		actionDuration: actionDuration,
 	}
 
 	return s, nil
 }
 
 func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
-	timer := prometheus.NewTimer(actionDuration.WithLabelValues(putActionName))
-	defer timer.ObserveDuration()
-
-	actionTotal.WithLabelValues(putActionName).Inc()
+	start := time.Now()
 
 	err := s.underlying.Put(ctx, kv)
 
-	if err != nil {
-		errorTotal.WithLabelValues(putActionName).Inc()
-	}
+	s.observe(putActionName, start, err)
 
 	return err
 }
 
 func (s *Storage) Delete(ctx context.Context, key microstorage.K) error {
-	timer := prometheus.NewTimer(actionDuration.WithLabelValues(deleteActionName))
-	defer timer.ObserveDuration()
-
-	actionTotal.WithLabelValues(deleteActionName).Inc()
+	start := time.Now()
 
 	err := s.underlying.Delete(ctx, key)
 
-	if err != nil {
-		errorTotal.WithLabelValues(deleteActionName).Inc()
-	}
+	s.observe(deleteActionName, start, err)
 
 	return err
 }
 
 func (s *Storage) Exists(ctx context.Context, key microstorage.K) (bool, error) {
-	timer := prometheus.NewTimer(actionDuration.WithLabelValues(existsActionName))
-	defer timer.ObserveDuration()
-
-	actionTotal.WithLabelValues(existsActionName).Inc()
+	start := time.Now()
 
 	b, err := s.underlying.Exists(ctx, key)
 
-	if err != nil {
-		errorTotal.WithLabelValues(existsActionName).Inc()
-	}
+	s.observe(existsActionName, start, err)
 
 	return b, err
 }
 
 func (s *Storage) List(ctx context.Context, key microstorage.K) ([]microstorage.KV, error) {
-	timer := prometheus.NewTimer(actionDuration.WithLabelValues(listActionName))
-	defer timer.ObserveDuration()
-
-	actionTotal.WithLabelValues(listActionName).Inc()
+	start := time.Now()
 
 	kvs, err := s.underlying.List(ctx, key)
 
-	if err != nil {
-		errorTotal.WithLabelValues(listActionName).Inc()
-	}
+	s.observe(listActionName, start, err)
 
 	return kvs, err
 }
 
 func (s *Storage) Search(ctx context.Context, key microstorage.K) (microstorage.KV, error) {
-	timer := prometheus.NewTimer(actionDuration.WithLabelValues(searchActionName))
-	defer timer.ObserveDuration()
-
-	actionTotal.WithLabelValues(searchActionName).Inc()
+	start := time.Now()
 
 	kv, err := s.underlying.Search(ctx, key)
 
-	if err != nil {
-		errorTotal.WithLabelValues(searchActionName).Inc()
-	}
+	s.observe(searchActionName, start, err)
 
 	return kv, err
 }
+
+// Watch passes the call through to the underlying storage if it implements
+// microstorage.Watcher. Otherwise it fails with microstorage.NotSupportedError.
+func (s *Storage) Watch(ctx context.Context, key microstorage.K) (<-chan microstorage.Event, error) {
+	start := time.Now()
+
+	w, ok := s.underlying.(microstorage.Watcher)
+	if !ok {
+		err := microerror.Maskf(microstorage.NotSupportedError, "%T does not implement microstorage.Watcher", s.underlying)
+		s.observe(watchActionName, start, err)
+		return nil, err
+	}
+
+	ch, err := w.Watch(ctx, key)
+
+	s.observe(watchActionName, start, err)
+
+	return ch, err
+}
+
+// observe records the duration and the outcome of an action. A value which
+// is not found is a regular outcome and not counted as error.
+func (s *Storage) observe(action string, start time.Time, err error) {
+	s.actionDuration.WithLabelValues(action).Observe(time.Since(start).Seconds())
+
+	outcome := successOutcome
+	if microstorage.IsNotFound(err) {
+		outcome = notFoundOutcome
+	} else if err != nil {
+		outcome = errorOutcome
+		s.errorTotal.WithLabelValues(action).Inc()
+	}
+
+	s.actionTotal.WithLabelValues(action, outcome).Inc()
+}
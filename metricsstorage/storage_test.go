@@ -1,8 +1,14 @@
 package metricsstorage
 
 import (
+	"context"
+	"strings"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/giantswarm/microstorage"
 	"github.com/giantswarm/microstorage/memory"
 	"github.com/giantswarm/microstorage/storagetest"
 )
@@ -23,3 +29,99 @@ func TestMetricsStorage(t *testing.T) {
 
 	storagetest.Test(t, storage)
 }
+
+func TestMetricsStorage_NotWatching(t *testing.T) {
+	underlying, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatalf("unexpected error %#v", err)
+	}
+
+	config := DefaultConfig()
+	// Hide the Watch method of the underlying storage.
+	config.Underlying = struct{ microstorage.Storage }{underlying}
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatalf("unexpected error %#v", err)
+	}
+
+	_, err = storage.Watch(context.Background(), microstorage.RootKey)
+	if !microstorage.IsNotSupported(err) {
+		t.Fatalf("expected NotSupportedError, got %#v", err)
+	}
+
+	storagetest.Test(t, storage)
+}
+
+func Test_Storage_Registerer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+
+	newStorage := func(backend string, underlying microstorage.Storage) *Storage {
+		config := DefaultConfig()
+		config.Underlying = underlying
+		config.Registerer = registry
+		config.Namespace = "test"
+		config.ConstLabels = prometheus.Labels{"backend": backend}
+
+		storage, err := New(config)
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+
+		return storage
+	}
+
+	underlying, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	a := newStorage("a", underlying)
+	// The storage of b does not implement microstorage.Watcher.
+	b := newStorage("b", struct{ microstorage.Storage }{underlying})
+	// Instances with equal configuration share their collectors.
+	shared := newStorage("a", underlying)
+
+	k := microstorage.MustK(microstorage.NewK("key"))
+
+	err = a.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "value")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = a.Search(ctx, k)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = b.Search(ctx, microstorage.MustK(microstorage.NewK("missing")))
+	if !microstorage.IsNotFound(err) {
+		t.Fatal("expected", microstorage.NotFoundError, "got", err)
+	}
+	_, err = shared.Watch(ctx, k)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = b.Watch(ctx, k)
+	if !microstorage.IsNotSupported(err) {
+		t.Fatal("expected", microstorage.NotSupportedError, "got", err)
+	}
+
+	expected := `
+# HELP test_action_total Total number of storage actions performed.
+# TYPE test_action_total counter
+test_action_total{action="put",backend="a",outcome="success"} 1
+test_action_total{action="search",backend="a",outcome="success"} 1
+test_action_total{action="search",backend="b",outcome="not_found"} 1
+test_action_total{action="watch",backend="a",outcome="success"} 1
+test_action_total{action="watch",backend="b",outcome="error"} 1
+# HELP test_error_total Total number of storage actions that have errored. Values not found are not counted.
+# TYPE test_error_total counter
+test_error_total{action="watch",backend="b"} 1
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "test_action_total", "test_error_total")
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+}
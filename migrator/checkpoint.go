@@ -0,0 +1,148 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// progress tracks which of the listed KVs are migrated. Keys are migrated
+// concurrently, so they complete out of order. Every dispatched KV gets a
+// sequence number in key order. The last key up to which all KVs are migrated
+// successfully is a safe checkpoint. Only the KVs after it are kept, so the
+// memory used does not grow with the size of the source storage.
+type progress struct {
+	mutex sync.Mutex
+
+	// keys and done track the dispatched KVs starting with sequence number
+	// base.
+	keys []string
+	done []bool
+	base int
+	// last is the current checkpoint. It is the checkpoint the migration
+	// resumed from while no KV is migrated yet.
+	last string
+	// failed is the sequence number of the first failed KV, or -1. The
+	// checkpoint never passes it, so later KVs are not tracked.
+	failed int
+
+	dispatched      int
+	processed       int
+	sinceCheckpoint int
+}
+
+func newProgress(resumedAfter string) *progress {
+	return &progress{
+		last:   resumedAfter,
+		failed: -1,
+	}
+}
+
+// add tracks the KV with the given key and returns its sequence number. KVs
+// must be added in key order.
+func (p *progress) add(key string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	seq := p.dispatched
+	p.dispatched++
+	if p.failed < 0 {
+		p.keys = append(p.keys, key)
+		p.done = append(p.done, false)
+	}
+
+	return seq
+}
+
+// markProcessed marks the KV with sequence number seq as processed. Failed
+// KVs hold back the checkpoint, so they are retried when the migration is
+// resumed. It returns the current checkpoint and whether it is due to be
+// persisted according to interval.
+func (p *progress) markProcessed(seq int, ok bool, interval int) (string, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.processed++
+	if i := seq - p.base; i < len(p.done) {
+		if ok {
+			p.done[i] = true
+		} else if p.failed < 0 {
+			p.failed = seq
+			p.keys = p.keys[:i+1]
+			p.done = p.done[:i+1]
+		}
+	}
+
+	n := 0
+	for n < len(p.done) && p.done[n] {
+		n++
+	}
+	if n > 0 {
+		p.last = p.keys[n-1]
+		p.keys = p.keys[n:]
+		p.done = p.done[n:]
+		p.base += n
+	}
+
+	p.sinceCheckpoint++
+	if p.sinceCheckpoint < interval {
+		return "", false
+	}
+	p.sinceCheckpoint = 0
+
+	return p.last, true
+}
+
+// count returns the number of processed KVs and the number of KVs dispatched
+// so far.
+func (p *progress) count() (int, int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.processed, p.dispatched
+}
+
+// checkpoint returns the key of the last KV up to which all KVs are migrated.
+func (p *progress) checkpoint() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.last
+}
+
+func (m *Migrator) readCheckpoint(ctx context.Context, dst microstorage.Storage) (string, error) {
+	kv, err := dst.Search(ctx, m.checkpointKey)
+	if microstorage.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return kv.Val(), nil
+}
+
+// checkpoint persists the checkpoint. Failing to do so does not fail the
+// migration, it only makes a resumed migration redo more work.
+func (m *Migrator) checkpoint(ctx context.Context, dst microstorage.Storage, key string) {
+	if key == "" {
+		return
+	}
+
+	err := dst.Put(ctx, microstorage.MustKV(microstorage.NewKV(m.checkpointKey.Key(), key)))
+	if err != nil {
+		m.logger.Log("warning", fmt.Sprintf("failed to persist checkpoint key=%s", key), "err", fmt.Sprintf("%#v", err))
+	}
+}
+
+func (m *Migrator) deleteCheckpoint(ctx context.Context, dst microstorage.Storage) error {
+	err := dst.Delete(ctx, m.checkpointKey)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package migrator
+
+import (
+	"github.com/giantswarm/microstorage"
+)
+
+// ConflictPolicy decides what happens with keys present in the destination
+// storage with a value differing from the source storage.
+type ConflictPolicy string
+
+const (
+	// ConflictPolicySkip keeps the value of the destination storage.
+	ConflictPolicySkip ConflictPolicy = "skip"
+	// ConflictPolicyOverwrite writes all values of the source storage, even
+	// when the destination storage holds an equal value already.
+	ConflictPolicyOverwrite ConflictPolicy = "overwrite"
+	// ConflictPolicyOverwriteIfDifferent writes values of the source storage
+	// only when they differ from the destination storage.
+	ConflictPolicyOverwriteIfDifferent ConflictPolicy = "overwrite-if-different"
+	// ConflictPolicyFail stops the migration with microstorage.ConflictError
+	// at the first conflict, regardless of Config.ContinueOnError.
+	ConflictPolicyFail ConflictPolicy = "fail"
+	// ConflictPolicyResolve lets Config.Resolver decide.
+	ConflictPolicyResolve ConflictPolicy = "resolve"
+)
+
+func (p ConflictPolicy) valid() bool {
+	switch p {
+	case ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyOverwriteIfDifferent, ConflictPolicyFail, ConflictPolicyResolve:
+		return true
+	}
+
+	return false
+}
+
+// Resolver resolves a conflict between the value of the source storage and
+// the differing value of the destination storage. The returned KV is written
+// to the destination storage unless it equals dst. It must have the same key
+// as src and dst.
+type Resolver func(src, dst microstorage.KV) (microstorage.KV, error)
+
+// Resolution describes how a conflict was resolved.
+type Resolution string
+
+const (
+	// ResolutionSkipped means the value of the destination storage was
+	// kept.
+	ResolutionSkipped Resolution = "skipped"
+	// ResolutionOverwritten means the value of the source storage was
+	// written.
+	ResolutionOverwritten Resolution = "overwritten"
+	// ResolutionResolved means a value returned by the Resolver, which
+	// differs from both values, was written.
+	ResolutionResolved Resolution = "resolved"
+	// ResolutionFailed means the conflict could not be resolved or the
+	// resolved value could not be written. The key is part of Report.Errors.
+	ResolutionFailed Resolution = "failed"
+)
+
+// Conflict is a key present in both storages with differing values.
+type Conflict struct {
+	Key        string     `json:"key"`
+	Resolution Resolution `json:"resolution"`
+}
@@ -10,3 +10,48 @@ var invalidConfigError = &microerror.Error{
 func IsInvalidConfig(err error) bool {
 	return microerror.Cause(err) == invalidConfigError
 }
+
+var invalidResolutionError = &microerror.Error{
+	Kind: "invalidResolutionError",
+}
+
+// IsInvalidResolution asserts invalidResolutionError.
+func IsInvalidResolution(err error) bool {
+	return microerror.Cause(err) == invalidResolutionError
+}
+
+var failedKeysError = &microerror.Error{
+	Kind: "failedKeysError",
+}
+
+// IsFailedKeys asserts failedKeysError.
+func IsFailedKeys(err error) bool {
+	return microerror.Cause(err) == failedKeysError
+}
+
+var invalidVersionError = &microerror.Error{
+	Kind: "invalidVersionError",
+}
+
+// IsInvalidVersion asserts invalidVersionError.
+func IsInvalidVersion(err error) bool {
+	return microerror.Cause(err) == invalidVersionError
+}
+
+var lockedError = &microerror.Error{
+	Kind: "lockedError",
+}
+
+// IsLocked asserts lockedError.
+func IsLocked(err error) bool {
+	return microerror.Cause(err) == lockedError
+}
+
+var unknownVersionError = &microerror.Error{
+	Kind: "unknownVersionError",
+}
+
+// IsUnknownVersion asserts unknownVersionError.
+func IsUnknownVersion(err error) bool {
+	return microerror.Cause(err) == unknownVersionError
+}
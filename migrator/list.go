@@ -0,0 +1,91 @@
+package migrator
+
+import (
+	"context"
+	"sort"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// pager lists all KVs of a storage page by page sorted by key, so migrations
+// process keys in a deterministic order. Storages implementing
+// microstorage.PagingStorage are listed one page at a time. All other storages
+// are listed at once with List, because Storage offers no other way.
+type pager struct {
+	storage microstorage.Storage
+	paging  microstorage.PagingStorage
+	size    int
+	// after is the key of the last listed KV.
+	after string
+
+	// listed are the remaining KVs of storages not implementing
+	// microstorage.PagingStorage.
+	listed []microstorage.KV
+	loaded bool
+}
+
+// newPager creates a pager listing the KVs with keys greater than after.
+func newPager(storage microstorage.Storage, after string, size int) *pager {
+	p := &pager{
+		storage: storage,
+		size:    size,
+		after:   after,
+	}
+	p.paging, _ = storage.(microstorage.PagingStorage)
+
+	return p
+}
+
+// next returns the next page. An empty page marks the end.
+func (p *pager) next(ctx context.Context) ([]microstorage.KV, error) {
+	if p.paging != nil {
+		page, err := p.paging.ListPage(ctx, microstorage.RootKey, p.after, p.size)
+		if microstorage.IsNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, microerror.Mask(err)
+		}
+		if len(page) > 0 {
+			p.after = page[len(page)-1].Key()
+		}
+
+		return page, nil
+	}
+
+	if !p.loaded {
+		kvs, err := listAll(ctx, p.storage)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		i := sort.Search(len(kvs), func(i int) bool { return kvs[i].Key() > p.after })
+		p.listed = kvs[i:]
+		p.loaded = true
+	}
+
+	n := p.size
+	if n > len(p.listed) {
+		n = len(p.listed)
+	}
+	page := p.listed[:n]
+	p.listed = p.listed[n:]
+
+	return page, nil
+}
+
+// listAll lists all KVs of the storage sorted by key. An empty storage
+// results in an empty list.
+func listAll(ctx context.Context, storage microstorage.Storage) ([]microstorage.KV, error) {
+	kvs, err := storage.List(ctx, microstorage.RootKey)
+	if microstorage.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key() < kvs[j].Key() })
+
+	return kvs, nil
+}
@@ -3,6 +3,8 @@ package migrator
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
@@ -12,17 +14,78 @@ import (
 
 type Config struct {
 	Logger micrologger.Logger
+
+	// ConflictPolicy decides what happens with keys present in the
+	// destination storage with a value differing from the source storage.
+	// It defaults to ConflictPolicySkip.
+	ConflictPolicy ConflictPolicy
+	// Resolver resolves conflicts. It is required for and only used with
+	// ConflictPolicyResolve.
+	Resolver Resolver
+	// Transforms are applied in order to every KV read from the source
+	// storage before it is migrated.
+	Transforms []Transform
+	// ContinueOnError makes the migration continue with the next key when
+	// migrating a key fails. All failed keys are listed in Report.Errors
+	// and the migration fails with an error matched by IsFailedKeys at the
+	// end. Conflicts under ConflictPolicyFail still stop the migration.
+	ContinueOnError bool
+
+	// Workers is the number of keys migrated concurrently. It defaults to
+	// 1, so keys are migrated in order.
+	Workers int
+	// CheckpointKey is the key in the destination storage the progress is
+	// persisted under, so an interrupted migration resumes where it
+	// stopped. The checkpoint is deleted when the migration succeeds. It
+	// must not be set when the destination storage is used for multiple
+	// migrations at the same time. It is disabled by default. A resumed
+	// migration of a source storage implementing
+	// microstorage.PagingStorage does not list the keys up to the
+	// checkpoint again.
+	CheckpointKey microstorage.K
+	// CheckpointInterval is the number of keys after which the checkpoint
+	// is persisted. It defaults to 100.
+	CheckpointInterval int
+	// ProgressInterval is the interval the progress is logged in. Zero
+	// disables progress logging. It defaults to 10 seconds.
+	ProgressInterval time.Duration
+	// PageSize is the number of KVs listed at once from storages
+	// implementing microstorage.PagingStorage. It defaults to 1000.
+	PageSize int
 }
 
 // DefaultConfig creates a new configuration with the default settings.
 func DefaultConfig() Config {
 	return Config{
 		Logger: nil, // Required.
+
+		ConflictPolicy: ConflictPolicySkip,
+		Resolver:       nil,
+
+		Transforms:      nil,
+		ContinueOnError: false,
+
+		Workers:            1,
+		CheckpointKey:      microstorage.K{},
+		CheckpointInterval: 100,
+		ProgressInterval:   10 * time.Second,
+		PageSize:           1000,
 	}
 }
 
 type Migrator struct {
 	logger micrologger.Logger
+
+	conflictPolicy  ConflictPolicy
+	resolver        Resolver
+	transforms      []Transform
+	continueOnError bool
+
+	workers            int
+	checkpointKey      microstorage.K
+	checkpointInterval int
+	progressInterval   time.Duration
+	pageSize           int
 }
 
 func New(config Config) (*Migrator, error) {
@@ -30,44 +93,388 @@ func New(config Config) (*Migrator, error) {
 		return nil, microerror.Maskf(invalidConfigError, "config.Logger is empty")
 	}
 
+	if config.ConflictPolicy == "" {
+		config.ConflictPolicy = ConflictPolicySkip
+	}
+	if !config.ConflictPolicy.valid() {
+		return nil, microerror.Maskf(invalidConfigError, "config.ConflictPolicy %q is unknown", config.ConflictPolicy)
+	}
+	if config.ConflictPolicy == ConflictPolicyResolve && config.Resolver == nil {
+		return nil, microerror.Maskf(invalidConfigError, "config.Resolver is empty")
+	}
+	if config.Workers == 0 {
+		config.Workers = 1
+	}
+	if config.Workers < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "config.Workers must not be negative")
+	}
+	if config.CheckpointKey == microstorage.RootKey {
+		return nil, microerror.Maskf(invalidConfigError, "config.CheckpointKey must not be the root key")
+	}
+	if config.CheckpointInterval == 0 {
+		config.CheckpointInterval = 100
+	}
+	if config.CheckpointInterval < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "config.CheckpointInterval must not be negative")
+	}
+	if config.ProgressInterval < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "config.ProgressInterval must not be negative")
+	}
+	if config.PageSize == 0 {
+		config.PageSize = 1000
+	}
+	if config.PageSize < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "config.PageSize must not be negative")
+	}
+
 	m := &Migrator{
 		logger: config.Logger,
+
+		conflictPolicy:  config.ConflictPolicy,
+		resolver:        config.Resolver,
+		transforms:      config.Transforms,
+		continueOnError: config.ContinueOnError,
+
+		workers:            config.Workers,
+		checkpointKey:      config.CheckpointKey,
+		checkpointInterval: config.CheckpointInterval,
+		progressInterval:   config.ProgressInterval,
+		pageSize:           config.PageSize,
 	}
 
 	return m, nil
 }
 
+// Migrate copies all values of src to dst. Conflicting values are handled
+// according to the configured ConflictPolicy.
+//
+// Keys are migrated in order. When src implements microstorage.PagingStorage
+// it is listed page by page, see Config.PageSize. Otherwise all KVs of src are
+// loaded into memory with a single List before migrating.
 func (m *Migrator) Migrate(ctx context.Context, dst, src microstorage.Storage) error {
+	_, err := m.MigrateWithReport(ctx, dst, src)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// MigrateWithReport works like Migrate and returns a report of what was
+// done. Report.OnlyInDst is not filled. On error the report covers the keys
+// processed until then.
+func (m *Migrator) MigrateWithReport(ctx context.Context, dst, src microstorage.Storage) (*Report, error) {
+	r, err := m.migrate(ctx, dst, src, false)
+	if err != nil {
+		return r, microerror.Mask(err)
+	}
+
+	m.logger.Log("info", fmt.Sprintf("migrated %d new entries, %d conflicts", len(r.Create), len(r.Conflicts)))
+	return r, nil
+}
+
+// DryRun compares src and dst and returns a report of what Migrate would do
+// without writing anything. Conflicts are reported with the resolution the
+// configured ConflictPolicy would apply. With ConflictPolicyFail DryRun does
+// not fail. On error the report covers the keys processed until then.
+func (m *Migrator) DryRun(ctx context.Context, dst, src microstorage.Storage) (*Report, error) {
+	r, migrateErr := m.migrate(ctx, dst, src, true)
+	if migrateErr != nil && !IsFailedKeys(migrateErr) {
+		return r, microerror.Mask(migrateErr)
+	}
+
+	srcKeys := map[string]bool{}
+	for _, keys := range [][]string{r.Create, r.Equal, r.Differ} {
+		for _, k := range keys {
+			srcKeys[k] = true
+		}
+	}
+
+	m.logger.Log("debug", "listing all dst KVs")
+	dstPager := newPager(dst, "", m.pageSize)
+	for {
+		page, err := dstPager.next(ctx)
+		if err != nil {
+			return r, microerror.Mask(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, kv := range page {
+			if !srcKeys[kv.Key()] && kv.Key() != m.checkpointKey.Key() {
+				r.OnlyInDst = append(r.OnlyInDst, kv.Key())
+			}
+		}
+	}
+
+	m.logger.Log("info", fmt.Sprintf("dry run: %d to create, %d equal, %d differing, %d only in dst", len(r.Create), len(r.Equal), len(r.Differ), len(r.OnlyInDst)))
+
+	if migrateErr != nil {
+		return r, microerror.Mask(migrateErr)
+	}
+
+	return r, nil
+}
+
+func (m *Migrator) migrate(ctx context.Context, dst, src microstorage.Storage, dryRun bool) (*Report, error) {
+	r := newReport()
+
 	var err error
+	checkpoint := m.checkpointKey != microstorage.K{} && !dryRun
+	if checkpoint {
+		r.ResumedAfter, err = m.readCheckpoint(ctx, dst)
+		if err != nil {
+			return r, microerror.Mask(err)
+		}
+	}
+	if r.ResumedAfter != "" {
+		m.logger.Log("info", fmt.Sprintf("resuming after key=%s", r.ResumedAfter))
+	}
 
-	m.logger.Log("debug", "listing all KVs")
-	kvs, err := src.List(ctx, microstorage.RootKey)
-	if microstorage.IsNotFound(err) {
-		m.logger.Log("debug", "src sotrage is empty")
-		return nil
-	} else if err != nil {
-		return microerror.Mask(err)
+	m.logger.Log("debug", "transfering entries")
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := newProgress(r.ResumedAfter)
+	stopLogging := m.logProgress(p)
+	defer stopLogging()
+
+	var (
+		mutex    sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	jobs := make(chan job)
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := range jobs {
+				if runCtx.Err() != nil {
+					continue
+				}
+
+				o, err := m.migrateKV(runCtx, dst, j.kv, dryRun)
+
+				mutex.Lock()
+				r.record(o)
+				if err != nil {
+					r.Errors = append(r.Errors, KeyError{Key: j.kv.Key(), Error: err.Error()})
+					// Conflicts stop the migration with
+					// ConflictPolicyFail, even when errors of
+					// other keys do not.
+					if !m.continueOnError || (m.conflictPolicy == ConflictPolicyFail && microstorage.IsConflict(err)) {
+						if firstErr == nil {
+							firstErr = err
+						}
+						cancel()
+					} else {
+						m.logger.Log("warning", fmt.Sprintf("failed to migrate key=%s", j.kv.Key()), "err", fmt.Sprintf("%#v", err))
+					}
+				}
+				mutex.Unlock()
+
+				key, due := p.markProcessed(j.seq, err == nil, m.checkpointInterval)
+				if checkpoint && due {
+					m.checkpoint(runCtx, dst, key)
+				}
+			}
+		}()
+	}
+
+	m.logger.Log("debug", "listing KVs")
+	srcPager := newPager(src, r.ResumedAfter, m.pageSize)
+loop:
+	for {
+		page, err := srcPager.next(runCtx)
+		if err != nil {
+			mutex.Lock()
+			// Listing fails when the migration is canceled, which
+			// is reported on its own.
+			if firstErr == nil && runCtx.Err() == nil {
+				firstErr = err
+			}
+			mutex.Unlock()
+			break
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, kv := range page {
+			if kv.Key() == m.checkpointKey.Key() {
+				continue
+			}
+
+			select {
+			case jobs <- job{seq: p.add(kv.Key()), kv: kv}:
+			case <-runCtx.Done():
+				break loop
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	r.sort()
+
+	switch {
+	case firstErr != nil:
+		err = firstErr
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case len(r.Errors) > 0:
+		err = microerror.Maskf(failedKeysError, "%d keys failed", len(r.Errors))
+	}
+
+	if checkpoint {
+		if err != nil {
+			// The context may be canceled, the checkpoint must be
+			// persisted anyway.
+			m.checkpoint(context.WithoutCancel(ctx), dst, p.checkpoint())
+		} else {
+			deleteErr := m.deleteCheckpoint(ctx, dst)
+			if deleteErr != nil {
+				return r, microerror.Mask(deleteErr)
+			}
+		}
+	}
+
+	if err != nil {
+		return r, microerror.Mask(err)
+	}
+
+	return r, nil
+}
+
+// job is a KV to migrate with its sequence number, see progress.
+type job struct {
+	seq int
+	kv  microstorage.KV
+}
+
+// logProgress logs the progress periodically until the returned function is
+// called.
+func (m *Migrator) logProgress(p *progress) func() {
+	if m.progressInterval == 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(m.progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				processed, total := p.count()
+				m.logger.Log("info", fmt.Sprintf("processed %d/%d listed entries", processed, total))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (m *Migrator) migrateKV(ctx context.Context, dst microstorage.Storage, kv microstorage.KV, dryRun bool) (outcome, error) {
+	srcKey := kv.Key()
+	kv, keep, err := m.transform(kv)
+	if err != nil {
+		return outcome{}, microerror.Mask(err)
+	}
+	if !keep {
+		return outcome{action: actionDrop, key: srcKey}, nil
 	}
 
-	m.logger.Log("debug", fmt.Sprintf("transfering %d entries", len(kvs)))
-	var migrated int
-	for _, kv := range kvs {
-		exists, err := dst.Exists(ctx, kv.K())
+	dstKV, err := dst.Search(ctx, kv.K())
+	if microstorage.IsNotFound(err) {
+		err := m.put(ctx, dst, kv, dryRun)
 		if err != nil {
-			return microerror.Mask(err)
+			return outcome{}, microerror.Mask(err)
 		}
 
-		if exists {
-			continue
+		return outcome{action: actionCreate, key: kv.Key()}, nil
+	} else if err != nil {
+		return outcome{}, microerror.Mask(err)
+	}
+
+	if dstKV.Val() == kv.Val() {
+		if m.conflictPolicy == ConflictPolicyOverwrite {
+			err := m.put(ctx, dst, kv, dryRun)
+			if err != nil {
+				return outcome{}, microerror.Mask(err)
+			}
 		}
 
-		err = dst.Put(ctx, kv)
+		return outcome{action: actionEqual, key: kv.Key()}, nil
+	}
+
+	resolved, resolution, err := m.resolve(kv, dstKV)
+	o := outcome{action: actionDiffer, key: kv.Key(), resolution: resolution}
+	if microstorage.IsConflict(err) && dryRun {
+		return o, nil
+	} else if err != nil {
+		return o, microerror.Mask(err)
+	}
+
+	if resolution == ResolutionSkipped {
+		return o, nil
+	}
+
+	err = m.put(ctx, dst, resolved, dryRun)
+	if err != nil {
+		o.resolution = ResolutionFailed
+		return o, microerror.Mask(err)
+	}
+
+	return o, nil
+}
+
+// resolve returns the KV to write for a conflict and the resolution.
+func (m *Migrator) resolve(src, dst microstorage.KV) (microstorage.KV, Resolution, error) {
+	switch m.conflictPolicy {
+	case ConflictPolicyOverwrite, ConflictPolicyOverwriteIfDifferent:
+		return src, ResolutionOverwritten, nil
+	case ConflictPolicyFail:
+		return microstorage.KV{}, ResolutionFailed, microerror.Maskf(microstorage.ConflictError, "key=%s", src.Key())
+	case ConflictPolicyResolve:
+		kv, err := m.resolver(src, dst)
 		if err != nil {
-			return microerror.Mask(err)
+			return microstorage.KV{}, ResolutionFailed, microerror.Mask(err)
+		}
+		if kv.Key() != src.Key() {
+			return microstorage.KV{}, ResolutionFailed, microerror.Maskf(invalidResolutionError, "key=%s resolved to key=%s", src.Key(), kv.Key())
+		}
+
+		switch kv.Val() {
+		case dst.Val():
+			return kv, ResolutionSkipped, nil
+		case src.Val():
+			return kv, ResolutionOverwritten, nil
+		default:
+			return kv, ResolutionResolved, nil
 		}
-		migrated++
+	default:
+		return microstorage.KV{}, ResolutionSkipped, nil
+	}
+}
+
+func (m *Migrator) put(ctx context.Context, dst microstorage.Storage, kv microstorage.KV, dryRun bool) error {
+	if dryRun {
+		return nil
+	}
+
+	err := dst.Put(ctx, kv)
+	if err != nil {
+		return microerror.Mask(err)
 	}
 
-	m.logger.Log("info", fmt.Sprintf("migrated %d/%d remaining entries", migrated, len(kvs)))
 	return nil
 }
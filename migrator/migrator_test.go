@@ -0,0 +1,808 @@
+package migrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/memory"
+)
+
+func newMigrator(t *testing.T) *Migrator {
+	config := DefaultConfig()
+	config.Logger = microloggertest.New()
+
+	return newMigratorWithConfig(t, config)
+}
+
+func newMigratorWithConfig(t *testing.T, config Config) *Migrator {
+	config.Logger = microloggertest.New()
+
+	m, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return m
+}
+
+func newMemory(t *testing.T, kvs map[string]string) *memory.Storage {
+	storage, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	for k, v := range kvs {
+		err := storage.Put(context.Background(), microstorage.MustKV(microstorage.NewKV(k, v)))
+		if err != nil {
+			t.Fatal("expected", nil, "got", err)
+		}
+	}
+
+	return storage
+}
+
+func values(t *testing.T, storage microstorage.Storage) map[string]string {
+	kvs, err := listAll(context.Background(), storage)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	vals := map[string]string{}
+	for _, kv := range kvs {
+		vals[kv.Key()] = kv.Val()
+	}
+
+	return vals
+}
+
+func Test_Migrator_DryRun(t *testing.T) {
+	testCases := []struct {
+		name           string
+		src            map[string]string
+		dst            map[string]string
+		expectedReport *Report
+	}{
+		{
+			name: "case 0: empty storages",
+			expectedReport: &Report{
+				Create:    []string{},
+				Equal:     []string{},
+				Differ:    []string{},
+				OnlyInDst: []string{},
+				Conflicts: []Conflict{},
+				Dropped:   []string{},
+				Errors:    []KeyError{},
+			},
+		},
+		{
+			name: "case 1: empty dst",
+			src:  map[string]string{"b": "2", "a/b": "1"},
+			expectedReport: &Report{
+				Create:    []string{"/a/b", "/b"},
+				Equal:     []string{},
+				Differ:    []string{},
+				OnlyInDst: []string{},
+				Conflicts: []Conflict{},
+				Dropped:   []string{},
+				Errors:    []KeyError{},
+			},
+		},
+		{
+			name: "case 2: all kinds of differences",
+			src:  map[string]string{"a": "1", "b": "2", "c": "3"},
+			dst:  map[string]string{"b": "2", "c": "4", "d": "5"},
+			expectedReport: &Report{
+				Create:    []string{"/a"},
+				Equal:     []string{"/b"},
+				Differ:    []string{"/c"},
+				OnlyInDst: []string{"/d"},
+				Conflicts: []Conflict{{Key: "/c", Resolution: ResolutionSkipped}},
+				Dropped:   []string{},
+				Errors:    []KeyError{},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := newMemory(t, tc.dst)
+			src := newMemory(t, tc.src)
+
+			report, err := newMigrator(t).DryRun(context.Background(), dst, src)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if !reflect.DeepEqual(report, tc.expectedReport) {
+				t.Fatal("expected", tc.expectedReport, "got", report)
+			}
+
+			// Nothing is written.
+			expected := map[string]string{}
+			for k, v := range tc.dst {
+				expected[microstorage.MustK(microstorage.NewK(k)).Key()] = v
+			}
+			if !reflect.DeepEqual(values(t, dst), expected) {
+				t.Fatal("expected", expected, "got", values(t, dst))
+			}
+		})
+	}
+}
+
+func Test_Report_Render(t *testing.T) {
+	report := &Report{
+		Create:    []string{"/a", "/b"},
+		Equal:     []string{},
+		Differ:    []string{"/c"},
+		OnlyInDst: []string{},
+		Conflicts: []Conflict{{Key: "/c", Resolution: ResolutionOverwritten}},
+		Dropped:   []string{"/d"},
+		Errors:    []KeyError{{Key: "/e", Error: "invalid value"}},
+	}
+
+	expectedText := `create: 2
+  /a
+  /b
+equal: 0
+differ: 1
+  /c
+only in dst: 0
+dropped: 1
+  /d
+conflicts: 1
+  /c (overwritten)
+errors: 1
+  /e: invalid value
+`
+	if report.String() != expectedText {
+		t.Fatal("expected", expectedText, "got", report.String())
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	expectedJSON := `{"create":["/a","/b"],"equal":[],"differ":["/c"],"onlyInDst":[],"conflicts":[{"key":"/c","resolution":"overwritten"}],"dropped":["/d"],"errors":[{"key":"/e","error":"invalid value"}]}`
+	if string(b) != expectedJSON {
+		t.Fatal("expected", expectedJSON, "got", string(b))
+	}
+}
+
+func Test_Migrator_ConflictPolicy(t *testing.T) {
+	merge := func(src, dst microstorage.KV) (microstorage.KV, error) {
+		return microstorage.NewKV(src.Key(), dst.Val()+src.Val())
+	}
+
+	testCases := []struct {
+		name              string
+		conflictPolicy    ConflictPolicy
+		resolver          Resolver
+		continueOnError   bool
+		expectedDst       map[string]string
+		expectedConflicts []Conflict
+		errorMatcher      func(error) bool
+		// dryRunErrorMatcher is used for the dry run, which does not
+		// fail on conflicts.
+		dryRunErrorMatcher func(error) bool
+	}{
+		{
+			name:              "case 0: skip",
+			conflictPolicy:    ConflictPolicySkip,
+			expectedDst:       map[string]string{"/a": "1", "/b": "2", "/c": "old"},
+			expectedConflicts: []Conflict{{Key: "/c", Resolution: ResolutionSkipped}},
+		},
+		{
+			name:              "case 1: overwrite",
+			conflictPolicy:    ConflictPolicyOverwrite,
+			expectedDst:       map[string]string{"/a": "1", "/b": "2", "/c": "3"},
+			expectedConflicts: []Conflict{{Key: "/c", Resolution: ResolutionOverwritten}},
+		},
+		{
+			name:              "case 2: overwrite if different",
+			conflictPolicy:    ConflictPolicyOverwriteIfDifferent,
+			expectedDst:       map[string]string{"/a": "1", "/b": "2", "/c": "3"},
+			expectedConflicts: []Conflict{{Key: "/c", Resolution: ResolutionOverwritten}},
+		},
+		{
+			name:              "case 3: fail",
+			conflictPolicy:    ConflictPolicyFail,
+			expectedDst:       map[string]string{"/a": "1", "/b": "2", "/c": "old"},
+			expectedConflicts: []Conflict{{Key: "/c", Resolution: ResolutionFailed}},
+			errorMatcher:      microstorage.IsConflict,
+		},
+		{
+			name:              "case 4: resolver merging values",
+			conflictPolicy:    ConflictPolicyResolve,
+			resolver:          merge,
+			expectedDst:       map[string]string{"/a": "1", "/b": "2", "/c": "old3"},
+			expectedConflicts: []Conflict{{Key: "/c", Resolution: ResolutionResolved}},
+		},
+		{
+			name:           "case 5: resolver keeping dst value",
+			conflictPolicy: ConflictPolicyResolve,
+			resolver: func(src, dst microstorage.KV) (microstorage.KV, error) {
+				return dst, nil
+			},
+			expectedDst:       map[string]string{"/a": "1", "/b": "2", "/c": "old"},
+			expectedConflicts: []Conflict{{Key: "/c", Resolution: ResolutionSkipped}},
+		},
+		{
+			name:           "case 6: resolver changing the key",
+			conflictPolicy: ConflictPolicyResolve,
+			resolver: func(src, dst microstorage.KV) (microstorage.KV, error) {
+				return microstorage.NewKV("d", src.Val())
+			},
+			expectedDst:        map[string]string{"/a": "1", "/b": "2", "/c": "old"},
+			expectedConflicts:  []Conflict{{Key: "/c", Resolution: ResolutionFailed}},
+			errorMatcher:       IsInvalidResolution,
+			dryRunErrorMatcher: IsInvalidResolution,
+		},
+		{
+			name:              "case 7: fail ignoring continue on error",
+			conflictPolicy:    ConflictPolicyFail,
+			continueOnError:   true,
+			expectedDst:       map[string]string{"/a": "1", "/b": "2", "/c": "old"},
+			expectedConflicts: []Conflict{{Key: "/c", Resolution: ResolutionFailed}},
+			errorMatcher:      microstorage.IsConflict,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			src := newMemory(t, map[string]string{"a": "1", "b": "2", "c": "3"})
+			dst := newMemory(t, map[string]string{"b": "2", "c": "old"})
+
+			config := DefaultConfig()
+			config.ConflictPolicy = tc.conflictPolicy
+			config.Resolver = tc.resolver
+			config.ContinueOnError = tc.continueOnError
+			m := newMigratorWithConfig(t, config)
+
+			// The dry run reports the same conflicts without writing
+			// and without failing.
+			report, err := m.DryRun(ctx, dst, src)
+			if tc.dryRunErrorMatcher != nil {
+				if !tc.dryRunErrorMatcher(err) {
+					t.Fatal("expected", true, "got", false)
+				}
+			} else if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			} else if !reflect.DeepEqual(report.Conflicts, tc.expectedConflicts) {
+				t.Fatal("expected", tc.expectedConflicts, "got", report.Conflicts)
+			}
+			expectedDst := map[string]string{"/b": "2", "/c": "old"}
+			if !reflect.DeepEqual(values(t, dst), expectedDst) {
+				t.Fatal("expected", expectedDst, "got", values(t, dst))
+			}
+
+			report, err = m.MigrateWithReport(ctx, dst, src)
+			if tc.errorMatcher != nil {
+				if !tc.errorMatcher(err) {
+					t.Fatal("expected", true, "got", false)
+				}
+			} else if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if !reflect.DeepEqual(report.Conflicts, tc.expectedConflicts) {
+				t.Fatal("expected", tc.expectedConflicts, "got", report.Conflicts)
+			}
+			if !reflect.DeepEqual(values(t, dst), tc.expectedDst) {
+				t.Fatal("expected", tc.expectedDst, "got", values(t, dst))
+			}
+		})
+	}
+}
+
+func Test_New(t *testing.T) {
+	testCases := []struct {
+		name           string
+		conflictPolicy ConflictPolicy
+		resolver       Resolver
+	}{
+		{
+			name:           "case 0: unknown conflict policy",
+			conflictPolicy: ConflictPolicy("unknown"),
+		},
+		{
+			name:           "case 1: resolve without resolver",
+			conflictPolicy: ConflictPolicyResolve,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Logger = microloggertest.New()
+			config.ConflictPolicy = tc.conflictPolicy
+			config.Resolver = tc.resolver
+
+			_, err := New(config)
+			if !IsInvalidConfig(err) {
+				t.Fatal("expected", invalidConfigError, "got", err)
+			}
+		})
+	}
+}
+
+func Test_Migrator_Transforms(t *testing.T) {
+	upper := func(kv microstorage.KV) (microstorage.KV, bool, error) {
+		kv, err := microstorage.NewKV(kv.Key(), strings.ToUpper(kv.Val()))
+		return kv, true, err
+	}
+	dropTmp := func(kv microstorage.KV) (microstorage.KV, bool, error) {
+		return kv, !strings.HasPrefix(kv.Key(), "/tmp/"), nil
+	}
+	failBroken := func(kv microstorage.KV) (microstorage.KV, bool, error) {
+		if kv.Val() == "broken" {
+			return microstorage.KV{}, false, errors.New("invalid value")
+		}
+		return kv, true, nil
+	}
+
+	testCases := []struct {
+		name            string
+		transforms      []Transform
+		continueOnError bool
+		expectedDst     map[string]string
+		expectedDropped []string
+		expectedErrors  []KeyError
+		errorMatcher    func(error) bool
+	}{
+		{
+			name:            "case 0: no transforms",
+			expectedDst:     map[string]string{"/a/b": "x", "/a/c": "y", "/tmp/d": "z"},
+			expectedDropped: []string{},
+			expectedErrors:  []KeyError{},
+		},
+		{
+			name: "case 1: move, rewrite and drop",
+			transforms: []Transform{
+				dropTmp,
+				Move(microstorage.MustK(microstorage.NewK("a")), microstorage.MustK(microstorage.NewK("new/a"))),
+				upper,
+			},
+			expectedDst:     map[string]string{"/new/a/b": "X", "/new/a/c": "Y"},
+			expectedDropped: []string{"/tmp/d"},
+			expectedErrors:  []KeyError{},
+		},
+		{
+			name:            "case 2: stop on error",
+			transforms:      []Transform{failBroken},
+			expectedDst:     map[string]string{"/a/b": "x"},
+			expectedDropped: []string{},
+			expectedErrors:  []KeyError{{Key: "/a/c", Error: "invalid value"}},
+			errorMatcher:    func(err error) bool { return err != nil && !IsFailedKeys(err) },
+		},
+		{
+			name:            "case 3: continue on error",
+			transforms:      []Transform{failBroken},
+			continueOnError: true,
+			expectedDst:     map[string]string{"/a/b": "x", "/tmp/d": "z"},
+			expectedDropped: []string{},
+			expectedErrors:  []KeyError{{Key: "/a/c", Error: "invalid value"}},
+			errorMatcher:    IsFailedKeys,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			src := newMemory(t, map[string]string{"a/b": "x", "a/c": "y", "tmp/d": "z"})
+			dst := newMemory(t, nil)
+
+			if len(tc.expectedErrors) > 0 {
+				err := src.Put(ctx, microstorage.MustKV(microstorage.NewKV("a/c", "broken")))
+				if err != nil {
+					t.Fatal("expected", nil, "got", err)
+				}
+			}
+
+			config := DefaultConfig()
+			config.Transforms = tc.transforms
+			config.ContinueOnError = tc.continueOnError
+			m := newMigratorWithConfig(t, config)
+
+			report, err := m.MigrateWithReport(ctx, dst, src)
+			if tc.errorMatcher != nil {
+				if !tc.errorMatcher(err) {
+					t.Fatal("expected", true, "got", false)
+				}
+			} else if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if !reflect.DeepEqual(report.Dropped, tc.expectedDropped) {
+				t.Fatal("expected", tc.expectedDropped, "got", report.Dropped)
+			}
+			if !reflect.DeepEqual(report.Errors, tc.expectedErrors) {
+				t.Fatal("expected", tc.expectedErrors, "got", report.Errors)
+			}
+			if !reflect.DeepEqual(values(t, dst), tc.expectedDst) {
+				t.Fatal("expected", tc.expectedDst, "got", values(t, dst))
+			}
+		})
+	}
+}
+
+func Test_Move(t *testing.T) {
+	testCases := []struct {
+		name        string
+		from        string
+		to          string
+		key         string
+		expectedKey string
+	}{
+		{
+			name:        "case 0: key below from",
+			from:        "a",
+			to:          "b/c",
+			key:         "a/x/y",
+			expectedKey: "/b/c/x/y",
+		},
+		{
+			name:        "case 1: from itself",
+			from:        "a",
+			to:          "b",
+			key:         "a",
+			expectedKey: "/b",
+		},
+		{
+			name:        "case 2: key sharing the prefix only",
+			from:        "a",
+			to:          "b",
+			key:         "ab",
+			expectedKey: "/ab",
+		},
+		{
+			name:        "case 3: key outside from",
+			from:        "a",
+			to:          "b",
+			key:         "c/a",
+			expectedKey: "/c/a",
+		},
+		{
+			name:        "case 4: from root",
+			from:        "/",
+			to:          "b",
+			key:         "a/x",
+			expectedKey: "/b/a/x",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			from := microstorage.RootKey
+			if tc.from != "/" {
+				from = microstorage.MustK(microstorage.NewK(tc.from))
+			}
+			to := microstorage.MustK(microstorage.NewK(tc.to))
+
+			kv, keep, err := Move(from, to)(microstorage.MustKV(microstorage.NewKV(tc.key, "v")))
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if !keep {
+				t.Fatal("expected", true, "got", keep)
+			}
+			if kv.Key() != tc.expectedKey {
+				t.Fatal("expected", tc.expectedKey, "got", kv.Key())
+			}
+			if kv.Val() != "v" {
+				t.Fatal("expected", "v", "got", kv.Val())
+			}
+		})
+	}
+}
+
+func newNumberedMemory(t *testing.T, n int) *memory.Storage {
+	kvs := map[string]string{}
+	for i := 0; i < n; i++ {
+		kvs[fmt.Sprintf("k-%03d", i)] = fmt.Sprintf("v-%03d", i)
+	}
+
+	return newMemory(t, kvs)
+}
+
+func Test_Migrator_Workers(t *testing.T) {
+	ctx := context.Background()
+	src := newNumberedMemory(t, 200)
+	dst := newMemory(t, nil)
+
+	config := DefaultConfig()
+	config.Workers = 8
+	config.CheckpointKey = microstorage.MustK(microstorage.NewK("migration/checkpoint"))
+	config.CheckpointInterval = 10
+	m := newMigratorWithConfig(t, config)
+
+	report, err := m.MigrateWithReport(ctx, dst, src)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if len(report.Create) != 200 {
+		t.Fatal("expected", 200, "got", len(report.Create))
+	}
+	if !reflect.DeepEqual(values(t, dst), values(t, src)) {
+		t.Fatal("expected", values(t, src), "got", values(t, dst))
+	}
+}
+
+func Test_Migrator_Resume(t *testing.T) {
+	testCases := []struct {
+		name            string
+		continueOnError bool
+		expectedDst     int
+	}{
+		{
+			name:            "case 0: stop on error",
+			continueOnError: false,
+			expectedDst:     20,
+		},
+		{
+			name:            "case 1: continue on error",
+			continueOnError: true,
+			expectedDst:     49,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			src := newNumberedMemory(t, 50)
+			dst := newMemory(t, nil)
+			checkpointKey := microstorage.MustK(microstorage.NewK("migration/checkpoint"))
+
+			config := DefaultConfig()
+			config.CheckpointKey = checkpointKey
+			config.CheckpointInterval = 5
+			config.ContinueOnError = tc.continueOnError
+			config.Transforms = []Transform{
+				func(kv microstorage.KV) (microstorage.KV, bool, error) {
+					if kv.Key() == "/k-020" {
+						return microstorage.KV{}, false, errors.New("invalid value")
+					}
+					return kv, true, nil
+				},
+			}
+
+			_, err := newMigratorWithConfig(t, config).MigrateWithReport(ctx, dst, src)
+			if err == nil {
+				t.Fatal("expected", "error", "got", nil)
+			}
+
+			// The failed key holds back the checkpoint.
+			kv, err := dst.Search(ctx, checkpointKey)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if kv.Val() != "/k-019" {
+				t.Fatal("expected", "/k-019", "got", kv.Val())
+			}
+			if len(values(t, dst)) != tc.expectedDst+1 {
+				t.Fatal("expected", tc.expectedDst+1, "got", len(values(t, dst)))
+			}
+
+			config.Transforms = nil
+			report, err := newMigratorWithConfig(t, config).MigrateWithReport(ctx, dst, src)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if report.ResumedAfter != "/k-019" {
+				t.Fatal("expected", "/k-019", "got", report.ResumedAfter)
+			}
+			if len(report.Create)+len(report.Equal) != 30 {
+				t.Fatal("expected", 30, "got", len(report.Create)+len(report.Equal))
+			}
+
+			// The checkpoint is deleted after the migration succeeded.
+			if !reflect.DeepEqual(values(t, dst), values(t, src)) {
+				t.Fatal("expected", values(t, src), "got", values(t, dst))
+			}
+		})
+	}
+}
+
+func Test_Migrator_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := newNumberedMemory(t, 50)
+	dst := newMemory(t, nil)
+	checkpointKey := microstorage.MustK(microstorage.NewK("migration/checkpoint"))
+
+	config := DefaultConfig()
+	config.CheckpointKey = checkpointKey
+	config.Transforms = []Transform{
+		func(kv microstorage.KV) (microstorage.KV, bool, error) {
+			if kv.Key() == "/k-010" {
+				cancel()
+			}
+			return kv, true, nil
+		},
+	}
+
+	err := newMigratorWithConfig(t, config).Migrate(ctx, dst, src)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("expected", context.Canceled, "got", err)
+	}
+
+	// The key being migrated while the context is canceled is completed,
+	// no other keys are migrated afterwards.
+	kv, err := dst.Search(context.Background(), checkpointKey)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if kv.Val() != "/k-010" {
+		t.Fatal("expected", "/k-010", "got", kv.Val())
+	}
+	if len(values(t, dst)) != 12 {
+		t.Fatal("expected", 12, "got", len(values(t, dst)))
+	}
+}
+
+// failingPutStorage fails to put the given keys.
+type failingPutStorage struct {
+	microstorage.Storage
+	keys map[string]bool
+}
+
+func (s failingPutStorage) Put(ctx context.Context, kv microstorage.KV) error {
+	if s.keys[kv.Key()] {
+		return errors.New("put failed")
+	}
+
+	return s.Storage.Put(ctx, kv)
+}
+
+func Test_Migrator_PutFailure(t *testing.T) {
+	ctx := context.Background()
+	src := newMemory(t, map[string]string{
+		"create":      "v",
+		"create-fail": "v",
+		"equal-fail":  "v",
+		"differ-fail": "new",
+	})
+	dst := failingPutStorage{
+		Storage: newMemory(t, map[string]string{
+			"equal-fail":  "v",
+			"differ-fail": "old",
+		}),
+		keys: map[string]bool{
+			"/create-fail": true,
+			"/equal-fail":  true,
+			"/differ-fail": true,
+		},
+	}
+
+	config := DefaultConfig()
+	config.ConflictPolicy = ConflictPolicyOverwrite
+	config.ContinueOnError = true
+	m := newMigratorWithConfig(t, config)
+
+	report, err := m.MigrateWithReport(ctx, dst, src)
+	if err == nil {
+		t.Fatal("expected", "error", "got", nil)
+	}
+
+	if !reflect.DeepEqual(report.Create, []string{"/create"}) {
+		t.Fatal("expected", []string{"/create"}, "got", report.Create)
+	}
+	if len(report.Equal) != 0 {
+		t.Fatal("expected", 0, "got", len(report.Equal))
+	}
+	expectedConflicts := []Conflict{{Key: "/differ-fail", Resolution: ResolutionFailed}}
+	if !reflect.DeepEqual(report.Conflicts, expectedConflicts) {
+		t.Fatal("expected", expectedConflicts, "got", report.Conflicts)
+	}
+
+	var keys []string
+	for _, e := range report.Errors {
+		keys = append(keys, e.Key)
+	}
+	expectedKeys := []string{"/create-fail", "/differ-fail", "/equal-fail"}
+	if !reflect.DeepEqual(keys, expectedKeys) {
+		t.Fatal("expected", expectedKeys, "got", keys)
+	}
+}
+
+// pagingStorage fails to list, so it has to be listed page by page. It records
+// the after argument of all ListPage calls.
+type pagingStorage struct {
+	*memory.Storage
+	afters *[]string
+}
+
+func (s pagingStorage) List(ctx context.Context, key microstorage.K) ([]microstorage.KV, error) {
+	return nil, errors.New("list called")
+}
+
+func (s pagingStorage) ListPage(ctx context.Context, key microstorage.K, after string, limit int) ([]microstorage.KV, error) {
+	*s.afters = append(*s.afters, after)
+	return s.Storage.ListPage(ctx, key, after, limit)
+}
+
+// listingStorage hides the microstorage.PagingStorage implementation of the
+// embedded storage.
+type listingStorage struct {
+	microstorage.Storage
+}
+
+func Test_Migrator_Paging(t *testing.T) {
+	testCases := []struct {
+		name           string
+		paging         bool
+		checkpoint     string
+		expectedAfters []string
+		expectedCreate int
+	}{
+		{
+			name:           "case 0: paging source",
+			paging:         true,
+			expectedAfters: []string{"", "/k-009", "/k-019", "/k-029", "/k-039", "/k-049"},
+			expectedCreate: 50,
+		},
+		{
+			name:           "case 1: paging source resumed",
+			paging:         true,
+			checkpoint:     "/k-024",
+			expectedAfters: []string{"/k-024", "/k-034", "/k-044", "/k-049"},
+			expectedCreate: 25,
+		},
+		{
+			name:           "case 2: listing source resumed",
+			paging:         false,
+			checkpoint:     "/k-024",
+			expectedCreate: 25,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			checkpointKey := microstorage.MustK(microstorage.NewK("migration/checkpoint"))
+			dst := newMemory(t, nil)
+			if tc.checkpoint != "" {
+				err := dst.Put(ctx, microstorage.MustKV(microstorage.NewKV(checkpointKey.Key(), tc.checkpoint)))
+				if err != nil {
+					t.Fatal("expected", nil, "got", err)
+				}
+			}
+
+			var afters []string
+			var src microstorage.Storage = listingStorage{Storage: newNumberedMemory(t, 50)}
+			if tc.paging {
+				src = pagingStorage{Storage: newNumberedMemory(t, 50), afters: &afters}
+			}
+
+			config := DefaultConfig()
+			config.Workers = 4
+			config.CheckpointKey = checkpointKey
+			config.CheckpointInterval = 3
+			config.PageSize = 10
+			m := newMigratorWithConfig(t, config)
+
+			report, err := m.MigrateWithReport(ctx, dst, src)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if !reflect.DeepEqual(afters, tc.expectedAfters) {
+				t.Fatal("expected", tc.expectedAfters, "got", afters)
+			}
+			if len(report.Create) != tc.expectedCreate {
+				t.Fatal("expected", tc.expectedCreate, "got", len(report.Create))
+			}
+			if report.Create[0] <= tc.checkpoint {
+				t.Fatal("expected", "key after "+tc.checkpoint, "got", report.Create[0])
+			}
+			if len(values(t, dst)) != tc.expectedCreate {
+				t.Fatal("expected", tc.expectedCreate, "got", len(values(t, dst)))
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package migrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Report describes the differences between a source and a destination
+// storage, i.e. what Migrate does or would do. All keys are sanitized and
+// sorted. Keys are the ones in the destination storage, i.e. after
+// Config.Transforms are applied, unless stated otherwise. Report can be
+// marshalled with encoding/json.
+type Report struct {
+	// Create are keys only present in the source storage. Migrate writes
+	// them to the destination storage.
+	Create []string `json:"create"`
+	// Equal are keys present in both storages with equal values.
+	Equal []string `json:"equal"`
+	// Differ are keys present in both storages with differing values.
+	Differ []string `json:"differ"`
+	// OnlyInDst are keys only present in the destination storage. Migrate
+	// leaves them alone.
+	OnlyInDst []string `json:"onlyInDst"`
+	// Conflicts are the keys of Differ together with the resolution applied
+	// according to the ConflictPolicy.
+	Conflicts []Conflict `json:"conflicts"`
+	// Dropped are keys of the source storage dropped by Config.Transforms.
+	Dropped []string `json:"dropped"`
+	// Errors are keys of the source storage which failed to migrate.
+	Errors []KeyError `json:"errors"`
+	// ResumedAfter is the key of the source storage after which a resumed
+	// migration continued. Keys up to it are not part of the report.
+	ResumedAfter string `json:"resumedAfter,omitempty"`
+}
+
+// KeyError is the error migrating a key.
+type KeyError struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+func newReport() *Report {
+	return &Report{
+		Create:    []string{},
+		Equal:     []string{},
+		Differ:    []string{},
+		OnlyInDst: []string{},
+		Conflicts: []Conflict{},
+		Dropped:   []string{},
+		Errors:    []KeyError{},
+	}
+}
+
+const (
+	actionCreate = "create"
+	actionEqual  = "equal"
+	actionDiffer = "differ"
+	actionDrop   = "drop"
+)
+
+// outcome is the outcome of migrating a single key. The zero outcome is not
+// recorded, e.g. for keys which failed to be written.
+type outcome struct {
+	action     string
+	key        string
+	resolution Resolution
+}
+
+func (r *Report) record(o outcome) {
+	switch o.action {
+	case actionCreate:
+		r.Create = append(r.Create, o.key)
+	case actionEqual:
+		r.Equal = append(r.Equal, o.key)
+	case actionDiffer:
+		r.Differ = append(r.Differ, o.key)
+		r.Conflicts = append(r.Conflicts, Conflict{Key: o.key, Resolution: o.resolution})
+	case actionDrop:
+		r.Dropped = append(r.Dropped, o.key)
+	}
+}
+
+func (r *Report) sort() {
+	sort.Strings(r.Create)
+	sort.Strings(r.Equal)
+	sort.Strings(r.Differ)
+	sort.Strings(r.OnlyInDst)
+	sort.Slice(r.Conflicts, func(i, j int) bool { return r.Conflicts[i].Key < r.Conflicts[j].Key })
+	sort.Strings(r.Dropped)
+	sort.Slice(r.Errors, func(i, j int) bool { return r.Errors[i].Key < r.Errors[j].Key })
+}
+
+// String renders the report as human readable text.
+func (r *Report) String() string {
+	var b strings.Builder
+
+	sections := []struct {
+		name string
+		keys []string
+	}{
+		{name: "create", keys: r.Create},
+		{name: "equal", keys: r.Equal},
+		{name: "differ", keys: r.Differ},
+		{name: "only in dst", keys: r.OnlyInDst},
+		{name: "dropped", keys: r.Dropped},
+	}
+
+	for _, s := range sections {
+		fmt.Fprintf(&b, "%s: %d\n", s.name, len(s.keys))
+		for _, k := range s.keys {
+			fmt.Fprintf(&b, "  %s\n", k)
+		}
+	}
+
+	fmt.Fprintf(&b, "conflicts: %d\n", len(r.Conflicts))
+	for _, c := range r.Conflicts {
+		fmt.Fprintf(&b, "  %s (%s)\n", c.Key, c.Resolution)
+	}
+
+	fmt.Fprintf(&b, "errors: %d\n", len(r.Errors))
+	for _, e := range r.Errors {
+		fmt.Fprintf(&b, "  %s: %s\n", e.Key, e.Error)
+	}
+
+	return b.String()
+}
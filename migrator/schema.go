@@ -0,0 +1,468 @@
+package migrator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/giantswarm/micrologger"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// Step is a numbered schema migration step evolving the data inside a
+// storage.
+type Step struct {
+	// Version is the schema version after the step is applied. Versions
+	// must be positive and unique.
+	Version int
+	// Name describes the step.
+	Name string
+	// Up applies the step to the storage. It should be idempotent, because
+	// it runs again when it fails before the version is stored.
+	Up func(ctx context.Context, storage microstorage.Storage) error
+}
+
+// SchemaConfig represents the configuration used to create a Schema.
+type SchemaConfig struct {
+	Logger micrologger.Logger
+	// Storage is the storage the steps are applied to. It also holds the
+	// version and the lock keys.
+	Storage microstorage.Storage
+
+	// Steps are the registered steps. They are applied ordered by version.
+	Steps []Step
+	// VersionKey is the key the current schema version is stored under.
+	VersionKey microstorage.K
+	// LockKey is the key of the lock preventing concurrent runs of Up.
+	LockKey microstorage.K
+	// LockTTL is the duration after which a lock is considered stale, e.g.
+	// because the runner holding it crashed. The lock is renewed before
+	// every step, so it must be longer than applying a single step takes.
+	LockTTL time.Duration
+	// Clock returns the current time. It is used to expire locks.
+	Clock func() time.Time
+}
+
+// DefaultSchemaConfig creates a new schema configuration with the default
+// settings.
+func DefaultSchemaConfig() SchemaConfig {
+	return SchemaConfig{
+		Logger:  nil, // Required.
+		Storage: nil, // Required.
+
+		Steps:      nil,
+		VersionKey: microstorage.MustK(microstorage.NewK("migrator/schema/version")),
+		LockKey:    microstorage.MustK(microstorage.NewK("migrator/schema/lock")),
+		LockTTL:    10 * time.Minute,
+		Clock:      time.Now,
+	}
+}
+
+// Schema applies versioned steps to a storage. The current version is stored
+// in the storage itself, so every step is applied once. Steps see the version
+// and the lock keys when listing the storage.
+//
+// The lock is safe against concurrent runners when the storage implements
+// microstorage.RevisionStorage. Otherwise it is best effort. A lock left
+// behind by a crashed runner is not removed from the storage. It records when
+// it expires and the next Up after that takes it over. Only when the storage
+// implements microstorage.TTLStorage but not microstorage.RevisionStorage is
+// the lock written with a TTL and removed by the storage itself.
+type Schema struct {
+	logger  micrologger.Logger
+	storage microstorage.Storage
+
+	steps      []Step
+	versionKey microstorage.K
+	lockKey    microstorage.K
+	lockTTL    time.Duration
+	clock      func() time.Time
+}
+
+// NewSchema creates a new configured Schema.
+func NewSchema(config SchemaConfig) (*Schema, error) {
+	if config.Logger == nil {
+		return nil, microerror.Maskf(invalidConfigError, "config.Logger is empty")
+	}
+	if config.Storage == nil {
+		return nil, microerror.Maskf(invalidConfigError, "config.Storage is empty")
+	}
+	if config.VersionKey == (microstorage.K{}) || config.VersionKey == microstorage.RootKey {
+		return nil, microerror.Maskf(invalidConfigError, "config.VersionKey must not be empty")
+	}
+	if config.LockKey == (microstorage.K{}) || config.LockKey == microstorage.RootKey {
+		return nil, microerror.Maskf(invalidConfigError, "config.LockKey must not be empty")
+	}
+	if config.VersionKey == config.LockKey {
+		return nil, microerror.Maskf(invalidConfigError, "config.VersionKey and config.LockKey must differ")
+	}
+	if config.LockTTL <= 0 {
+		return nil, microerror.Maskf(invalidConfigError, "config.LockTTL must be positive")
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+
+	steps := append([]Step(nil), config.Steps...)
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Version < steps[j].Version })
+	for i, step := range steps {
+		if step.Version <= 0 {
+			return nil, microerror.Maskf(invalidConfigError, "step %q version must be positive", step.Name)
+		}
+		if i > 0 && steps[i-1].Version == step.Version {
+			return nil, microerror.Maskf(invalidConfigError, "step version %d must be unique", step.Version)
+		}
+		if step.Up == nil {
+			return nil, microerror.Maskf(invalidConfigError, "step %d Up must not be empty", step.Version)
+		}
+	}
+
+	s := &Schema{
+		logger:  config.Logger,
+		storage: config.Storage,
+
+		steps:      steps,
+		versionKey: config.VersionKey,
+		lockKey:    config.LockKey,
+		lockTTL:    config.LockTTL,
+		clock:      config.Clock,
+	}
+
+	return s, nil
+}
+
+// SchemaStatus is the status of the schema of a storage.
+type SchemaStatus struct {
+	// Version is the current schema version. It is 0 when no step was
+	// applied yet.
+	Version int `json:"version"`
+	// Applied are the steps with a version up to the current version.
+	Applied []StepStatus `json:"applied"`
+	// Pending are the steps Up applies.
+	Pending []StepStatus `json:"pending"`
+}
+
+// StepStatus identifies a step in SchemaStatus.
+type StepStatus struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// Status returns the current version together with the applied and the
+// pending steps.
+func (s *Schema) Status(ctx context.Context) (*SchemaStatus, error) {
+	version, err := s.version(ctx)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	status := &SchemaStatus{
+		Version: version,
+		Applied: []StepStatus{},
+		Pending: []StepStatus{},
+	}
+	for _, step := range s.steps {
+		st := StepStatus{Version: step.Version, Name: step.Name}
+		if step.Version <= version {
+			status.Applied = append(status.Applied, st)
+		} else {
+			status.Pending = append(status.Pending, st)
+		}
+	}
+
+	return status, nil
+}
+
+// Up applies all pending steps in order. The version is stored after every
+// step, so a failed run continues with the failed step next time. Up fails
+// with an error matched by IsLocked when another runner holds the lock, also
+// when the lock was taken over while applying a step. It fails with an error
+// matched by IsUnknownVersion when the stored version is higher than the
+// version of the last registered step, e.g. because the storage was migrated
+// by a newer release.
+func (s *Schema) Up(ctx context.Context) error {
+	owner, err := s.lock(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	defer func() {
+		// The lock must be released even when the context is canceled.
+		err := s.unlock(context.WithoutCancel(ctx), owner)
+		if err != nil {
+			s.logger.Log("warning", "failed to release schema lock", "err", fmt.Sprintf("%#v", err))
+		}
+	}()
+
+	version, err := s.version(ctx)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+	var last int
+	if len(s.steps) > 0 {
+		last = s.steps[len(s.steps)-1].Version
+	}
+	if version > last {
+		return microerror.Maskf(unknownVersionError, "key=%s holds version %d, last registered step is %d", s.versionKey.Key(), version, last)
+	}
+
+	var applied int
+	for _, step := range s.steps {
+		if step.Version <= version {
+			continue
+		}
+		if ctx.Err() != nil {
+			return microerror.Mask(ctx.Err())
+		}
+
+		// The previous steps may have taken a good part of the lock
+		// TTL.
+		err := s.renew(ctx, owner)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		s.logger.Log("info", fmt.Sprintf("applying schema step %d %q", step.Version, step.Name))
+
+		err = step.Up(ctx, s.storage)
+		if err != nil {
+			s.logger.Log("error", fmt.Sprintf("failed to apply schema step %d %q", step.Version, step.Name), "err", fmt.Sprintf("%#v", err))
+			return microerror.Mask(err)
+		}
+
+		err = s.storage.Put(ctx, microstorage.MustKV(microstorage.NewKV(s.versionKey.Key(), strconv.Itoa(step.Version))))
+		if err != nil {
+			return microerror.Mask(err)
+		}
+
+		applied++
+	}
+
+	s.logger.Log("info", fmt.Sprintf("applied %d schema steps", applied))
+	return nil
+}
+
+func (s *Schema) version(ctx context.Context) (int, error) {
+	kv, err := s.storage.Search(ctx, s.versionKey)
+	if microstorage.IsNotFound(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, microerror.Mask(err)
+	}
+
+	version, err := strconv.Atoi(kv.Val())
+	if err != nil {
+		return 0, microerror.Maskf(invalidVersionError, "key=%s: %s", s.versionKey.Key(), err)
+	}
+
+	return version, nil
+}
+
+// schemaLock is the value stored under the lock key.
+type schemaLock struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// lock acquires the lock and returns the owner identifying the lock holder.
+func (s *Schema) lock(ctx context.Context) (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+	owner := hex.EncodeToString(b)
+
+	kv, err := s.lockKV(owner)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	if rs, ok := s.storage.(microstorage.RevisionStorage); ok {
+		_, err := rs.PutIfAbsent(ctx, kv)
+		if microstorage.IsConflict(err) {
+			// Take over a stale lock only when it was not modified
+			// in the meantime.
+			current, rev, err := rs.SearchWithRevision(ctx, s.lockKey)
+			if err != nil {
+				return "", microerror.Mask(err)
+			}
+			err = s.checkStale(current)
+			if err != nil {
+				return "", microerror.Mask(err)
+			}
+			_, err = rs.PutIfRevision(ctx, kv, rev)
+			if microstorage.IsConflict(err) {
+				return "", microerror.Maskf(lockedError, "key=%s", s.lockKey.Key())
+			} else if err != nil {
+				return "", microerror.Mask(err)
+			}
+		} else if err != nil {
+			return "", microerror.Mask(err)
+		}
+
+		return owner, nil
+	}
+
+	current, err := s.storage.Search(ctx, s.lockKey)
+	if err == nil {
+		err = s.checkStale(current)
+		if err != nil {
+			return "", microerror.Mask(err)
+		}
+	} else if !microstorage.IsNotFound(err) {
+		return "", microerror.Mask(err)
+	}
+
+	err = s.putLock(ctx, kv)
+	if err != nil {
+		return "", microerror.Mask(err)
+	}
+
+	return owner, nil
+}
+
+// renew extends the lock held by owner by the lock TTL. It fails with
+// lockedError when the lock was taken over by another owner.
+func (s *Schema) renew(ctx context.Context, owner string) error {
+	kv, err := s.lockKV(owner)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	if rs, ok := s.storage.(microstorage.RevisionStorage); ok {
+		current, rev, err := rs.SearchWithRevision(ctx, s.lockKey)
+		if microstorage.IsNotFound(err) {
+			return microerror.Maskf(lockedError, "key=%s lost", s.lockKey.Key())
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+		err = s.checkOwner(current, owner)
+		if err != nil {
+			return microerror.Mask(err)
+		}
+		_, err = rs.PutIfRevision(ctx, kv, rev)
+		if microstorage.IsConflict(err) {
+			return microerror.Maskf(lockedError, "key=%s lost", s.lockKey.Key())
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+
+		return nil
+	}
+
+	current, err := s.storage.Search(ctx, s.lockKey)
+	if microstorage.IsNotFound(err) {
+		return microerror.Maskf(lockedError, "key=%s lost", s.lockKey.Key())
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+	err = s.checkOwner(current, owner)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	err = s.putLock(ctx, kv)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// lockKV returns the lock held by owner expiring after the lock TTL.
+func (s *Schema) lockKV(owner string) (microstorage.KV, error) {
+	val, err := json.Marshal(schemaLock{Owner: owner, Expires: s.clock().Add(s.lockTTL)})
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(s.lockKey.Key(), string(val))), nil
+}
+
+// putLock writes the lock to storages not implementing
+// microstorage.RevisionStorage.
+func (s *Schema) putLock(ctx context.Context, kv microstorage.KV) error {
+	var err error
+	if ts, ok := s.storage.(microstorage.TTLStorage); ok {
+		err = ts.PutWithTTL(ctx, kv, s.lockTTL)
+	} else {
+		err = s.storage.Put(ctx, kv)
+	}
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// checkOwner fails with lockedError unless the lock is held by owner.
+func (s *Schema) checkOwner(kv microstorage.KV, owner string) error {
+	var l schemaLock
+	err := json.Unmarshal([]byte(kv.Val()), &l)
+	if err != nil || l.Owner != owner {
+		return microerror.Maskf(lockedError, "key=%s taken over", s.lockKey.Key())
+	}
+
+	return nil
+}
+
+// checkStale fails with lockedError unless the lock is expired.
+func (s *Schema) checkStale(kv microstorage.KV) error {
+	var l schemaLock
+	err := json.Unmarshal([]byte(kv.Val()), &l)
+	if err != nil {
+		return microerror.Maskf(lockedError, "key=%s holds an invalid lock: %s", s.lockKey.Key(), err)
+	}
+
+	if s.clock().Before(l.Expires) {
+		return microerror.Maskf(lockedError, "key=%s held by %s until %s", s.lockKey.Key(), l.Owner, l.Expires.Format(time.RFC3339))
+	}
+
+	s.logger.Log("warning", fmt.Sprintf("taking over stale schema lock held by %s", l.Owner))
+	return nil
+}
+
+// unlock releases the lock unless it was taken over by another owner.
+func (s *Schema) unlock(ctx context.Context, owner string) error {
+	var current microstorage.KV
+	var rev int64
+	var err error
+	rs, revisions := s.storage.(microstorage.RevisionStorage)
+	if revisions {
+		current, rev, err = rs.SearchWithRevision(ctx, s.lockKey)
+	} else {
+		current, err = s.storage.Search(ctx, s.lockKey)
+	}
+	if microstorage.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return microerror.Mask(err)
+	}
+
+	var l schemaLock
+	err = json.Unmarshal([]byte(current.Val()), &l)
+	if err != nil || l.Owner != owner {
+		return nil
+	}
+
+	if revisions {
+		err = rs.DeleteIfRevision(ctx, s.lockKey, rev)
+		if microstorage.IsConflict(err) || microstorage.IsNotFound(err) {
+			return nil
+		}
+	} else {
+		err = s.storage.Delete(ctx, s.lockKey)
+	}
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
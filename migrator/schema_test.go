@@ -0,0 +1,381 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/giantswarm/micrologger/microloggertest"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+// plainStorage hides all optional interfaces of the underlying storage.
+type plainStorage struct {
+	microstorage.Storage
+}
+
+func newSchema(t *testing.T, storage microstorage.Storage, clock *storagetest.Clock, steps ...Step) *Schema {
+	config := DefaultSchemaConfig()
+	config.Logger = microloggertest.New()
+	config.Storage = storage
+	config.Steps = steps
+	config.Clock = clock.Now
+
+	s, err := NewSchema(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return s
+}
+
+// recordingStep returns a step putting its version under the key "applied"
+// and counting how often it is applied.
+func recordingStep(version int, name string, calls map[int]int) Step {
+	return Step{
+		Version: version,
+		Name:    name,
+		Up: func(ctx context.Context, storage microstorage.Storage) error {
+			calls[version]++
+			return storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("applied", name)))
+		},
+	}
+}
+
+func Test_Schema_Up(t *testing.T) {
+	testCases := []struct {
+		name    string
+		storage func(t *testing.T) microstorage.Storage
+	}{
+		{
+			name: "case 0: revision storage",
+			storage: func(t *testing.T) microstorage.Storage {
+				return newMemory(t, nil)
+			},
+		},
+		{
+			name: "case 1: plain storage",
+			storage: func(t *testing.T) microstorage.Storage {
+				return plainStorage{Storage: newMemory(t, nil)}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := tc.storage(t)
+			clock := storagetest.NewClock()
+			calls := map[int]int{}
+
+			steps := []Step{
+				recordingStep(2, "two", calls),
+				recordingStep(1, "one", calls),
+			}
+
+			status, err := newSchema(t, storage, clock, steps...).Status(ctx)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			expectedStatus := &SchemaStatus{
+				Version: 0,
+				Applied: []StepStatus{},
+				Pending: []StepStatus{{Version: 1, Name: "one"}, {Version: 2, Name: "two"}},
+			}
+			if !reflect.DeepEqual(status, expectedStatus) {
+				t.Fatal("expected", expectedStatus, "got", status)
+			}
+
+			err = newSchema(t, storage, clock, steps...).Up(ctx)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+
+			// Only the new step is applied.
+			steps = append(steps, recordingStep(3, "three", calls))
+			err = newSchema(t, storage, clock, steps...).Up(ctx)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+
+			expectedCalls := map[int]int{1: 1, 2: 1, 3: 1}
+			if !reflect.DeepEqual(calls, expectedCalls) {
+				t.Fatal("expected", expectedCalls, "got", calls)
+			}
+			kv, err := storage.Search(ctx, microstorage.MustK(microstorage.NewK("applied")))
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if kv.Val() != "three" {
+				t.Fatal("expected", "three", "got", kv.Val())
+			}
+
+			status, err = newSchema(t, storage, clock, steps...).Status(ctx)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			expectedStatus = &SchemaStatus{
+				Version: 3,
+				Applied: []StepStatus{{Version: 1, Name: "one"}, {Version: 2, Name: "two"}, {Version: 3, Name: "three"}},
+				Pending: []StepStatus{},
+			}
+			if !reflect.DeepEqual(status, expectedStatus) {
+				t.Fatal("expected", expectedStatus, "got", status)
+			}
+
+			// The lock is released.
+			exists, err := storage.Exists(ctx, DefaultSchemaConfig().LockKey)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if exists {
+				t.Fatal("expected", false, "got", exists)
+			}
+		})
+	}
+}
+
+func Test_Schema_UpFailure(t *testing.T) {
+	ctx := context.Background()
+	storage := newMemory(t, nil)
+	clock := storagetest.NewClock()
+	calls := map[int]int{}
+
+	failing := Step{
+		Version: 2,
+		Name:    "two",
+		Up: func(ctx context.Context, storage microstorage.Storage) error {
+			return errors.New("failed")
+		},
+	}
+
+	err := newSchema(t, storage, clock, recordingStep(1, "one", calls), failing).Up(ctx)
+	if err == nil {
+		t.Fatal("expected", "error", "got", nil)
+	}
+
+	status, err := newSchema(t, storage, clock, recordingStep(1, "one", calls), failing).Status(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if status.Version != 1 {
+		t.Fatal("expected", 1, "got", status.Version)
+	}
+
+	// The failed step is applied again by the next run.
+	err = newSchema(t, storage, clock, recordingStep(1, "one", calls), recordingStep(2, "two", calls)).Up(ctx)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	expectedCalls := map[int]int{1: 1, 2: 1}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Fatal("expected", expectedCalls, "got", calls)
+	}
+}
+
+func Test_Schema_Lock(t *testing.T) {
+	testCases := []struct {
+		name    string
+		storage func(t *testing.T) microstorage.Storage
+	}{
+		{
+			name: "case 0: revision storage",
+			storage: func(t *testing.T) microstorage.Storage {
+				return newMemory(t, nil)
+			},
+		},
+		{
+			name: "case 1: plain storage",
+			storage: func(t *testing.T) microstorage.Storage {
+				return plainStorage{Storage: newMemory(t, nil)}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := tc.storage(t)
+			clock := storagetest.NewClock()
+			calls := map[int]int{}
+
+			// Simulate a runner holding the lock.
+			other := newSchema(t, storage, clock)
+			_, err := other.lock(ctx)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+
+			s := newSchema(t, storage, clock, recordingStep(1, "one", calls))
+			err = s.Up(ctx)
+			if !IsLocked(err) {
+				t.Fatal("expected", lockedError, "got", err)
+			}
+			if len(calls) != 0 {
+				t.Fatal("expected", 0, "got", len(calls))
+			}
+
+			// A stale lock is taken over.
+			clock.Add(DefaultSchemaConfig().LockTTL)
+			err = s.Up(ctx)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			if calls[1] != 1 {
+				t.Fatal("expected", 1, "got", calls[1])
+			}
+		})
+	}
+}
+
+func Test_Schema_LockRenewal(t *testing.T) {
+	testCases := []struct {
+		name    string
+		storage func(t *testing.T) microstorage.Storage
+	}{
+		{
+			name: "case 0: revision storage",
+			storage: func(t *testing.T) microstorage.Storage {
+				return newMemory(t, nil)
+			},
+		},
+		{
+			name: "case 1: plain storage",
+			storage: func(t *testing.T) microstorage.Storage {
+				return plainStorage{Storage: newMemory(t, nil)}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := tc.storage(t)
+			clock := storagetest.NewClock()
+			other := newSchema(t, storage, clock)
+			ttl := DefaultSchemaConfig().LockTTL
+
+			// slowStep takes more than half of the lock TTL and
+			// tries to take the lock at its end.
+			var lockErrs []error
+			slowStep := func(version int) Step {
+				return Step{
+					Version: version,
+					Name:    "slow",
+					Up: func(ctx context.Context, storage microstorage.Storage) error {
+						clock.Add(ttl * 6 / 10)
+						_, err := other.lock(ctx)
+						lockErrs = append(lockErrs, err)
+						return nil
+					},
+				}
+			}
+
+			// The lock is renewed before every step, so it is not
+			// stale after the second step.
+			err := newSchema(t, storage, clock, slowStep(1), slowStep(2)).Up(ctx)
+			if err != nil {
+				t.Fatal("expected", nil, "got", err)
+			}
+			for _, err := range lockErrs {
+				if !IsLocked(err) {
+					t.Fatal("expected", lockedError, "got", err)
+				}
+			}
+
+			// A lock taken over while applying a step stops the
+			// run before the next step.
+			calls := map[int]int{}
+			staleStep := Step{
+				Version: 3,
+				Name:    "stale",
+				Up: func(ctx context.Context, storage microstorage.Storage) error {
+					clock.Add(ttl)
+					_, err := other.lock(ctx)
+					if err != nil {
+						t.Fatal("expected", nil, "got", err)
+					}
+					return nil
+				},
+			}
+			err = newSchema(t, storage, clock, slowStep(1), slowStep(2), staleStep, recordingStep(4, "four", calls)).Up(ctx)
+			if !IsLocked(err) {
+				t.Fatal("expected", lockedError, "got", err)
+			}
+			if len(calls) != 0 {
+				t.Fatal("expected", 0, "got", len(calls))
+			}
+		})
+	}
+}
+
+func Test_Schema_UnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	storage := newMemory(t, map[string]string{"migrator/schema/version": "3"})
+	clock := storagetest.NewClock()
+	calls := map[int]int{}
+
+	s := newSchema(t, storage, clock, recordingStep(1, "one", calls), recordingStep(2, "two", calls))
+	err := s.Up(ctx)
+	if !IsUnknownVersion(err) {
+		t.Fatal("expected", unknownVersionError, "got", err)
+	}
+	if len(calls) != 0 {
+		t.Fatal("expected", 0, "got", len(calls))
+	}
+
+	// The lock is released.
+	_, err = storage.Search(ctx, DefaultSchemaConfig().LockKey)
+	if !microstorage.IsNotFound(err) {
+		t.Fatal("expected", "not found", "got", err)
+	}
+}
+
+func Test_NewSchema(t *testing.T) {
+	up := func(ctx context.Context, storage microstorage.Storage) error { return nil }
+
+	testCases := []struct {
+		name  string
+		steps []Step
+		ttl   time.Duration
+	}{
+		{
+			name:  "case 0: non-positive version",
+			steps: []Step{{Version: 0, Name: "zero", Up: up}},
+			ttl:   time.Minute,
+		},
+		{
+			name:  "case 1: duplicate version",
+			steps: []Step{{Version: 1, Name: "one", Up: up}, {Version: 1, Name: "other", Up: up}},
+			ttl:   time.Minute,
+		},
+		{
+			name:  "case 2: missing up",
+			steps: []Step{{Version: 1, Name: "one"}},
+			ttl:   time.Minute,
+		},
+		{
+			name: "case 3: non-positive lock TTL",
+			ttl:  0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultSchemaConfig()
+			config.Logger = microloggertest.New()
+			config.Storage = newMemory(t, nil)
+			config.Steps = tc.steps
+			config.LockTTL = tc.ttl
+
+			_, err := NewSchema(config)
+			if !IsInvalidConfig(err) {
+				t.Fatal("expected", invalidConfigError, "got", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package migrator
+
+import (
+	"strings"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// Transform transforms a KV read from the source storage before it is
+// migrated. It may rename the key, rewrite the value or both. Returning false
+// drops the KV, i.e. it is not migrated.
+type Transform func(kv microstorage.KV) (microstorage.KV, bool, error)
+
+// Move returns a Transform relocating the sub-tree below from, including from
+// itself, to below to. Other keys are left alone.
+func Move(from, to microstorage.K) Transform {
+	return func(kv microstorage.KV) (microstorage.KV, bool, error) {
+		var rest string
+		switch {
+		case kv.Key() == from.Key():
+		case from.Key() == "/":
+			rest = kv.Key()
+		case strings.HasPrefix(kv.Key(), from.Key()+"/"):
+			rest = strings.TrimPrefix(kv.Key(), from.Key())
+		default:
+			return kv, true, nil
+		}
+
+		moved, err := microstorage.NewKV(strings.TrimSuffix(to.Key(), "/")+rest, kv.Val())
+		if err != nil {
+			return microstorage.KV{}, false, microerror.Mask(err)
+		}
+
+		return moved, true, nil
+	}
+}
+
+// transform applies all configured transforms in order.
+func (m *Migrator) transform(kv microstorage.KV) (microstorage.KV, bool, error) {
+	for _, t := range m.transforms {
+		var keep bool
+		var err error
+		kv, keep, err = t(kv)
+		if err != nil {
+			return microstorage.KV{}, false, microerror.Mask(err)
+		}
+		if !keep {
+			return microstorage.KV{}, false, nil
+		}
+	}
+
+	return kv, true, nil
+}
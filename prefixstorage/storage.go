@@ -0,0 +1,179 @@
+// Package prefixstorage provides a storage implementation scoping an
+// underlying storage to the sub-tree below a prefix key.
+//
+// All keys are joined onto the prefix before they are passed to the
+// underlying storage, so "a/b" becomes "<prefix>/a/b". Keys returned to the
+// caller never contain the prefix and listing RootKey only returns the
+// scoped sub-tree. The value stored under the prefix key itself is not part
+// of the scope.
+package prefixstorage
+
+import (
+	"context"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// Config represents the configuration used to create a prefixed storage.
+type Config struct {
+	// Underlying is the storage holding the scoped sub-tree.
+	Underlying microstorage.Storage
+
+	// Prefix is the key the sub-tree is rooted at. It must not be
+	// RootKey.
+	Prefix microstorage.K
+}
+
+// DefaultConfig provides a default configuration to create a new prefixed
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Underlying: nil, // Required.
+
+		Prefix: microstorage.K{}, // Required.
+	}
+}
+
+// New creates a new configured prefixed storage.
+func New(config Config) (*Storage, error) {
+	if config.Underlying == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Underlying must not be empty", config)
+	}
+	if config.Prefix.Key() == "" || config.Prefix.Key() == "/" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Prefix must not be empty", config)
+	}
+
+	s := &Storage{
+		underlying: config.Underlying,
+
+		prefix: config.Prefix.Key(),
+	}
+
+	return s, nil
+}
+
+// Storage is the prefixed storage.
+type Storage struct {
+	// Dependencies.
+
+	underlying microstorage.Storage
+
+	// Settings.
+
+	prefix string
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	err := s.underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV(s.join(kv.Key()), kv.Val())))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	// The value of the prefix key itself is out of scope.
+	if k.Key() == "/" {
+		return nil
+	}
+
+	err := s.underlying.Delete(ctx, s.joinK(k))
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	if k.Key() == "/" {
+		return false, nil
+	}
+
+	exists, err := s.underlying.Exists(ctx, s.joinK(k))
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	// Keys listed by the underlying storage are relative to the listed key
+	// already, so they never contain the prefix.
+	list, err := s.underlying.List(ctx, s.joinK(k))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	if k.Key() == "/" {
+		return microstorage.KV{}, microerror.Maskf(microstorage.NotFoundError, "key=%s", k.Key())
+	}
+
+	kv, err := s.underlying.Search(ctx, s.joinK(k))
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(k.Key(), kv.Val())), nil
+}
+
+// Watch passes the call through to the underlying storage if it implements
+// microstorage.Watcher. The prefix is stripped from the keys of the emitted
+// events. Otherwise it fails with microstorage.NotSupportedError.
+func (s *Storage) Watch(ctx context.Context, k microstorage.K) (<-chan microstorage.Event, error) {
+	w, ok := s.underlying.(microstorage.Watcher)
+	if !ok {
+		return nil, microerror.Maskf(microstorage.NotSupportedError, "%T does not implement microstorage.Watcher", s.underlying)
+	}
+
+	events, err := w.Watch(ctx, s.joinK(k))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	ch := make(chan microstorage.Event)
+
+	go func() {
+		defer close(ch)
+
+		for e := range events {
+			key := e.KV.Key()[len(s.prefix):]
+			if key == "" {
+				// Changes of the prefix key itself are out of
+				// scope.
+				continue
+			}
+
+			e.KV = microstorage.MustKV(microstorage.NewKV(key, e.KV.Val()))
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- e:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// join returns the key of the underlying storage for the given sanitized key.
+func (s *Storage) join(key string) string {
+	if key == "/" {
+		return s.prefix
+	}
+
+	return s.prefix + key
+}
+
+func (s *Storage) joinK(k microstorage.K) microstorage.K {
+	return microstorage.MustK(microstorage.NewK(s.join(k.Key())))
+}
@@ -0,0 +1,118 @@
+package prefixstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/memory"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func newStorage(t *testing.T, underlying microstorage.Storage, prefix string) *Storage {
+	config := DefaultConfig()
+	config.Underlying = underlying
+	config.Prefix = microstorage.MustK(microstorage.NewK(prefix))
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage
+}
+
+func newMemory(t *testing.T) *memory.Storage {
+	storage, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage
+}
+
+func Test_Storage(t *testing.T) {
+	for _, prefix := range []string{"component", "team/component"} {
+		t.Run(prefix, func(t *testing.T) {
+			underlying := newMemory(t)
+
+			// Values outside of the scope must not show up.
+			for _, key := range []string{prefix, prefix + "-sibling/key", "other/key"} {
+				err := underlying.Put(context.Background(), microstorage.MustKV(microstorage.NewKV(key, "outside")))
+				if err != nil {
+					t.Fatal("expected", nil, "got", err)
+				}
+			}
+
+			storagetest.Test(t, newStorage(t, underlying, prefix))
+		})
+	}
+}
+
+func Test_Storage_Scope(t *testing.T) {
+	ctx := context.Background()
+	underlying := newMemory(t)
+
+	a := newStorage(t, underlying, "a")
+	b := newStorage(t, underlying, "b")
+
+	err := a.Put(ctx, microstorage.MustKV(microstorage.NewKV("x/y", "1")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = b.Put(ctx, microstorage.MustKV(microstorage.NewKV("x/y", "2")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = underlying.Put(ctx, microstorage.MustKV(microstorage.NewKV("a", "prefix value")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	// Keys are joined onto the prefix.
+	kv, err := underlying.Search(ctx, microstorage.MustK(microstorage.NewK("a/x/y")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if kv.Val() != "1" {
+		t.Fatal("expected", "1", "got", kv.Val())
+	}
+
+	// Returned keys do not contain the prefix.
+	kv, err = b.Search(ctx, microstorage.MustK(microstorage.NewK("x/y")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if kv.Key() != "/x/y" || kv.Val() != "2" {
+		t.Fatal("expected", "/x/y=2", "got", kv.Key()+"="+kv.Val())
+	}
+
+	// Listing the root only returns the scoped sub-tree.
+	list, err := a.List(ctx, microstorage.RootKey)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if len(list) != 1 || list[0].Key() != "/x/y" || list[0].Val() != "1" {
+		t.Fatal("expected", "[/x/y=1]", "got", list)
+	}
+	list, err = a.List(ctx, microstorage.MustK(microstorage.NewK("x")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if len(list) != 1 || list[0].Key() != "/y" {
+		t.Fatal("expected", "[/y=1]", "got", list)
+	}
+
+	// The value of the prefix key itself is out of scope.
+	exists, err := a.Exists(ctx, microstorage.RootKey)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if exists {
+		t.Fatal("expected", false, "got", exists)
+	}
+	_, err = a.Search(ctx, microstorage.RootKey)
+	if !microstorage.IsNotFound(err) {
+		t.Fatal("expected", microstorage.NotFoundError, "got", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Package readonlystorage provides a storage implementation which can reject
+// all writes to an underlying storage.
+//
+// While the storage is read-only Put and Delete fail with
+// microstorage.ReadOnlyError and reads are passed through. The mode can be
+// switched at runtime, e.g. to stop all writes of a live service during
+// maintenance. Optional interfaces of the underlying storage which allow
+// writes are not exposed.
+package readonlystorage
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// Config represents the configuration used to create a read-only storage.
+type Config struct {
+	// Underlying is the storage writes are rejected for.
+	Underlying microstorage.Storage
+
+	// ReadOnly is the initial mode. Use SetReadOnly to change it later.
+	ReadOnly bool
+}
+
+// DefaultConfig provides a default configuration to create a new read-only
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Underlying: nil, // Required.
+
+		ReadOnly: true,
+	}
+}
+
+// New creates a new configured read-only storage.
+func New(config Config) (*Storage, error) {
+	if config.Underlying == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Underlying must not be empty", config)
+	}
+
+	s := &Storage{
+		underlying: config.Underlying,
+	}
+	s.readOnly.Store(config.ReadOnly)
+
+	return s, nil
+}
+
+// Storage is the read-only storage.
+type Storage struct {
+	// Dependencies.
+
+	underlying microstorage.Storage
+
+	// Internals.
+
+	readOnly atomic.Bool
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	if s.readOnly.Load() {
+		return microerror.Maskf(microstorage.ReadOnlyError, "key=%s", kv.Key())
+	}
+
+	err := s.underlying.Put(ctx, kv)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	if s.readOnly.Load() {
+		return microerror.Maskf(microstorage.ReadOnlyError, "key=%s", k.Key())
+	}
+
+	err := s.underlying.Delete(ctx, k)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	exists, err := s.underlying.Exists(ctx, k)
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	list, err := s.underlying.List(ctx, k)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	kv, err := s.underlying.Search(ctx, k)
+	if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	return kv, nil
+}
+
+// Watch passes the call through to the underlying storage if it implements
+// microstorage.Watcher. Otherwise it fails with microstorage.NotSupportedError.
+func (s *Storage) Watch(ctx context.Context, k microstorage.K) (<-chan microstorage.Event, error) {
+	w, ok := s.underlying.(microstorage.Watcher)
+	if !ok {
+		return nil, microerror.Maskf(microstorage.NotSupportedError, "%T does not implement microstorage.Watcher", s.underlying)
+	}
+
+	ch, err := w.Watch(ctx, k)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return ch, nil
+}
+
+// ReadOnly tells whether writes are currently rejected.
+func (s *Storage) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// SetReadOnly switches the mode. Writes in flight when the storage is
+// switched to read-only mode are not interrupted.
+func (s *Storage) SetReadOnly(readOnly bool) {
+	s.readOnly.Store(readOnly)
+}
@@ -0,0 +1,87 @@
+package readonlystorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/memory"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func newStorage(t *testing.T, readOnly bool) (*Storage, *memory.Storage) {
+	underlying, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	config := DefaultConfig()
+	config.Underlying = underlying
+	config.ReadOnly = readOnly
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage, underlying
+}
+
+func Test_Storage(t *testing.T) {
+	storage, _ := newStorage(t, false)
+	storagetest.Test(t, storage)
+}
+
+func Test_Storage_ReadOnly(t *testing.T) {
+	ctx := context.Background()
+	storage, underlying := newStorage(t, true)
+
+	kv := microstorage.MustKV(microstorage.NewKV("key", "value"))
+
+	err := underlying.Put(ctx, kv)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	if !storage.ReadOnly() {
+		t.Fatal("expected", true, "got", false)
+	}
+
+	// Writes are rejected.
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "changed")))
+	if !microstorage.IsReadOnly(err) {
+		t.Fatal("expected", microstorage.ReadOnlyError, "got", err)
+	}
+	err = storage.Delete(ctx, kv.K())
+	if !microstorage.IsReadOnly(err) {
+		t.Fatal("expected", microstorage.ReadOnlyError, "got", err)
+	}
+
+	// Reads are passed through.
+	got, err := storage.Search(ctx, kv.K())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if got != kv {
+		t.Fatal("expected", kv, "got", got)
+	}
+
+	// Optional interfaces allowing writes are not exposed.
+	if _, ok := interface{}(storage).(microstorage.RevisionStorage); ok {
+		t.Fatal("expected", false, "got", true)
+	}
+
+	// Writes are accepted again after switching the mode.
+	storage.SetReadOnly(false)
+	err = storage.Delete(ctx, kv.K())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	exists, err := underlying.Exists(ctx, kv.K())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	if exists {
+		t.Fatal("expected", false, "got", exists)
+	}
+}
@@ -0,0 +1,21 @@
+package redisstorage
+
+import "github.com/giantswarm/microerror"
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidTTLError = &microerror.Error{
+	Kind: "invalidTTLError",
+}
+
+// IsInvalidTTL asserts invalidTTLError.
+func IsInvalidTTL(err error) bool {
+	return microerror.Cause(err) == invalidTTLError
+}
@@ -0,0 +1,20 @@
+module github.com/giantswarm/microstorage/redisstorage
+
+go 1.22
+
+require (
+	github.com/alicebob/miniredis/v2 v2.37.0
+	github.com/giantswarm/microerror v0.4.1
+	github.com/giantswarm/microstorage v0.2.3-0.20261016234144-90a9870bc809
+	github.com/redis/go-redis/v9 v9.9.0
+	github.com/stretchr/testify v1.10.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
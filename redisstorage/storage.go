@@ -0,0 +1,272 @@
+// Package redisstorage provides a Redis backed storage implementation.
+//
+// Every value is stored in its own Redis string under "{<prefix>}:v:<key>".
+// To list keys without scanning the whole Redis key space, every directory has
+// a sorted set "{<prefix>}:i:<dir>" indexing all keys nested under it. E.g. the key
+// "/a/b/c" is a member of the sets of "/", "/a" and "/a/b". Values and index
+// entries are modified together in MULTI/EXEC transactions.
+//
+// The prefix is a hash tag, so all Redis keys of a storage are mapped to the
+// same hash slot and the transactions work with Redis Cluster too. All data
+// of a storage is therefore held by a single shard. Use multiple storages with
+// different prefixes to spread data across shards.
+//
+// Values stored with PutWithTTL are expired by Redis. Their stale index
+// entries are removed lazily by List.
+package redisstorage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/giantswarm/microerror"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// Config represents the configuration used to create a Redis backed storage.
+type Config struct {
+	// Client is the Redis client.
+	Client redis.UniversalClient
+
+	// Prefix is prepended to all Redis keys managed by the storage as a
+	// hash tag. It must not contain curly braces.
+	Prefix string
+}
+
+// DefaultConfig provides a default configuration to create a new Redis backed
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Client: nil, // Required.
+
+		Prefix: "microstorage",
+	}
+}
+
+// New creates a new configured Redis storage.
+func New(config Config) (*Storage, error) {
+	if config.Client == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Client must not be empty", config)
+	}
+	if config.Prefix == "" {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Prefix must not be empty", config)
+	}
+	if strings.ContainsAny(config.Prefix, "{}") {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Prefix must not contain curly braces", config)
+	}
+
+	storage := &Storage{
+		client: config.Client,
+		prefix: config.Prefix,
+	}
+
+	return storage, nil
+}
+
+// Storage is the Redis backed storage.
+type Storage struct {
+	// Dependencies.
+
+	client redis.UniversalClient
+
+	// Settings.
+
+	prefix string
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	err := s.put(ctx, kv, 0)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) PutWithTTL(ctx context.Context, kv microstorage.KV, ttl time.Duration) error {
+	if ttl <= 0 {
+		return microerror.Maskf(invalidTTLError, "ttl must be positive, got %s", ttl)
+	}
+
+	err := s.put(ctx, kv, ttl)
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	key := k.Key()
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.valueKey(key))
+		for _, dir := range ancestors(key) {
+			pipe.ZRem(ctx, s.indexKey(dir), key)
+		}
+		return nil
+	})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	n, err := s.client.Exists(ctx, s.valueKey(k.Key())).Result()
+	if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return n > 0, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	key := k.Key()
+
+	// The index holds only keys nested under the listed key, so keys
+	// which are not separated by slash are ignored. When there is a key
+	// stored like "foo/bar/baz", listing keys using "foo/ba" should not
+	// succeed.
+	members, err := s.client.ZRange(ctx, s.indexKey(key), 0, -1).Result()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	valueKeys := make([]string, len(members))
+	for i, m := range members {
+		valueKeys[i] = s.valueKey(m)
+	}
+
+	values, err := s.client.MGet(ctx, valueKeys...).Result()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	i := len(key)
+	if key == "/" {
+		i = 0
+	}
+
+	var list []microstorage.KV
+	var expired []string
+	for j, v := range values {
+		val, ok := v.(string)
+		if !ok {
+			// The value expired or was deleted in the meantime.
+			expired = append(expired, members[j])
+			continue
+		}
+
+		k := members[j][i+1:]
+		list = append(list, microstorage.MustKV(microstorage.NewKV(k, val)))
+	}
+
+	if len(expired) > 0 {
+		err = s.cleanIndex(ctx, expired)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+	}
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	key := k.Key()
+
+	val, err := s.client.Get(ctx, s.valueKey(key)).Result()
+	if errors.Is(err, redis.Nil) {
+		return microstorage.KV{}, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+	} else if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(key, val)), nil
+}
+
+// put stores the value and adds the key to the indexes of all its ancestors.
+// Zero ttl stores the value without expiration.
+func (s *Storage) put(ctx context.Context, kv microstorage.KV, ttl time.Duration) error {
+	key := kv.Key()
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.valueKey(key), kv.Val(), ttl)
+		for _, dir := range ancestors(key) {
+			pipe.ZAdd(ctx, s.indexKey(dir), redis.Z{Member: key})
+		}
+		return nil
+	})
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+// cleanIndex removes index entries of keys which values do not exist anymore.
+// The removal is guarded with WATCH, so a key stored again concurrently is not
+// removed from the index.
+func (s *Storage) cleanIndex(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		valueKey := s.valueKey(key)
+
+		err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+			n, err := tx.Exists(ctx, valueKey).Result()
+			if err != nil {
+				return microerror.Mask(err)
+			}
+			if n > 0 {
+				return nil
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, dir := range ancestors(key) {
+					pipe.ZRem(ctx, s.indexKey(dir), key)
+				}
+				return nil
+			})
+			if err != nil {
+				return microerror.Mask(err)
+			}
+
+			return nil
+		}, valueKey)
+		if errors.Is(err, redis.TxFailedErr) {
+			// The key was modified concurrently and is not stale.
+			continue
+		} else if err != nil {
+			return microerror.Mask(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) valueKey(key string) string {
+	return "{" + s.prefix + "}:v:" + key
+}
+
+func (s *Storage) indexKey(dir string) string {
+	return "{" + s.prefix + "}:i:" + dir
+}
+
+// ancestors returns all directories the given sanitized key is nested under,
+// e.g. "/", "/a" and "/a/b" for "/a/b/c".
+func ancestors(key string) []string {
+	dirs := []string{"/"}
+	for i := 1; i < len(key); i++ {
+		if key[i] == '/' {
+			dirs = append(dirs, key[:i])
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,103 @@
+package redisstorage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func Test_Storage(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	storagetest.Test(t, storage)
+}
+
+func Test_Storage_TTL(t *testing.T) {
+	ctx := context.Background()
+	storage, mr := newTestStorage(t)
+
+	dir := microstorage.MustK(microstorage.NewK("ttl"))
+	kv := microstorage.MustKV(microstorage.NewKV("ttl/ephemeral", "value"))
+	persistent := microstorage.MustKV(microstorage.NewKV("ttl/persistent", "value"))
+
+	require.NoError(t, storage.PutWithTTL(ctx, kv, time.Minute))
+	require.NoError(t, storage.Put(ctx, persistent))
+
+	mr.FastForward(time.Minute - time.Second)
+
+	ok, err := storage.Exists(ctx, kv.K())
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	mr.FastForward(time.Second)
+
+	ok, err = storage.Exists(ctx, kv.K())
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	list, err := storage.List(ctx, dir)
+	require.NoError(t, err)
+	require.Equal(t, []microstorage.KV{microstorage.MustKV(microstorage.NewKV("persistent", "value"))}, list)
+
+	// List removes the stale index entries of expired values.
+	for _, d := range ancestors(kv.Key()) {
+		members, err := mr.ZMembers(storage.indexKey(d))
+		require.NoError(t, err)
+		require.NotContains(t, members, kv.Key())
+	}
+
+	err = storage.PutWithTTL(ctx, kv, 0)
+	require.True(t, IsInvalidTTL(err))
+}
+
+func Test_Storage_HashSlot(t *testing.T) {
+	ctx := context.Background()
+	storage, mr := newTestStorage(t)
+
+	require.NoError(t, storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("a/b/c", "value"))))
+
+	// All Redis keys must share the hash tag, so the MULTI/EXEC
+	// transactions do not span hash slots in Redis Cluster.
+	keys := mr.Keys()
+	require.NotEmpty(t, keys)
+	for _, k := range keys {
+		require.True(t, strings.HasPrefix(k, "{microstorage}:"), "key=%s", k)
+	}
+
+	config := DefaultConfig()
+	config.Client = storage.client
+	config.Prefix = "{a}"
+	_, err := New(config)
+	require.True(t, IsInvalidConfig(err))
+}
+
+func Test_ancestors(t *testing.T) {
+	require.Equal(t, []string{"/"}, ancestors("/a"))
+	require.Equal(t, []string{"/", "/a", "/a/b"}, ancestors("/a/b/c"))
+}
+
+func newTestStorage(t *testing.T) (*Storage, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	config := DefaultConfig()
+	config.Client = client
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage, mr
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	cenkaltibackoff "github.com/cenkalti/backoff/v4"
 	"github.com/giantswarm/backoff"
 	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger"
@@ -12,17 +13,45 @@ import (
 	"github.com/giantswarm/microstorage"
 )
 
+// Operation names passed to Config.IsRetryable.
+const (
+	OpDelete = "delete"
+	OpExists = "exists"
+	OpList   = "list"
+	OpPut    = "put"
+	OpSearch = "search"
+	OpWatch  = "watch"
+)
+
 type Config struct {
 	Logger     micrologger.Logger
 	Underlying microstorage.Storage
 
+	// NewBackOffFunc creates the backoff for operations which have no more
+	// specific backoff configured.
 	NewBackOffFunc func() backoff.Interface
+	// NewReadBackOffFunc creates the backoff for Exists, List, Search and
+	// Watch. It defaults to NewBackOffFunc.
+	NewReadBackOffFunc func() backoff.Interface
+	// NewWriteBackOffFunc creates the backoff for Put and Delete. It
+	// defaults to NewBackOffFunc.
+	NewWriteBackOffFunc func() backoff.Interface
+	// AttemptTimeout bounds the duration of a single attempt. Zero means
+	// attempts are only bounded by the context passed by the caller.
+	AttemptTimeout time.Duration
+	// IsRetryable decides whether the error returned by the given operation
+	// is retried. It defaults to DefaultIsRetryable.
+	IsRetryable func(op string, err error) bool
 }
 
 type Storage struct {
-	logger         micrologger.Logger
-	underlying     microstorage.Storage
-	newBackOffFunc func() backoff.Interface
+	logger     micrologger.Logger
+	underlying microstorage.Storage
+
+	newReadBackOffFunc  func() backoff.Interface
+	newWriteBackOffFunc func() backoff.Interface
+	attemptTimeout      time.Duration
+	isRetryable         func(op string, err error) bool
 }
 
 func New(config Config) (*Storage, error) {
@@ -32,105 +61,174 @@ func New(config Config) (*Storage, error) {
 	if config.Underlying == nil {
 		return nil, microerror.Maskf(invalidConfigError, "%T.Underlying must not be empty", config)
 	}
+	if config.AttemptTimeout < 0 {
+		return nil, microerror.Maskf(invalidConfigError, "%T.AttemptTimeout must not be negative", config)
+	}
 
 	if config.NewBackOffFunc == nil {
 		config.NewBackOffFunc = func() backoff.Interface {
 			return backoff.NewMaxRetries(3, backoff.ShortMaxInterval)
 		}
 	}
+	if config.NewReadBackOffFunc == nil {
+		config.NewReadBackOffFunc = config.NewBackOffFunc
+	}
+	if config.NewWriteBackOffFunc == nil {
+		config.NewWriteBackOffFunc = config.NewBackOffFunc
+	}
+	if config.IsRetryable == nil {
+		config.IsRetryable = DefaultIsRetryable
+	}
 
 	s := &Storage{
 		logger:     config.Logger,
 		underlying: config.Underlying,
 
-		newBackOffFunc: config.NewBackOffFunc,
+		newReadBackOffFunc:  config.NewReadBackOffFunc,
+		newWriteBackOffFunc: config.NewWriteBackOffFunc,
+		attemptTimeout:      config.AttemptTimeout,
+		isRetryable:         config.IsRetryable,
 	}
 
 	return s, nil
 }
 
-func (s *Storage) Delete(ctx context.Context, key microstorage.K) error {
-	b := s.newBackOffFunc()
-	op := func() error {
-		err := s.underlying.Delete(ctx, key)
-		if microstorage.IsInvalidKey(err) || microstorage.IsNotFound(err) {
-			return backoff.Permanent(err)
-		}
-		return err
+// DefaultIsRetryable retries all errors except the ones which can not be
+// resolved by trying again, i.e. microstorage.InvalidKeyError,
+// microstorage.NotFoundError, microstorage.NotSupportedError,
+// microstorage.ConflictError and microstorage.ReadOnlyError. Errors marked
+// with microstorage.TransientError are always retried.
+func DefaultIsRetryable(op string, err error) bool {
+	if microstorage.IsTransient(err) {
+		return true
 	}
-	notify := func(err error, delay time.Duration) {
-		s.logger.Log("warning", "retrying", "op", "delete", "key", key, "delay", delay, "err", fmt.Sprintf("%#v", err))
+
+	switch {
+	case microstorage.IsInvalidKey(err):
+		return false
+	case microstorage.IsNotFound(err):
+		return false
+	case microstorage.IsNotSupported(err):
+		return false
+	case microstorage.IsConflict(err):
+		return false
+	case microstorage.IsReadOnly(err):
+		return false
 	}
-	err := backoff.RetryNotify(op, b, notify)
+
+	return true
+}
+
+// TransientIsRetryable only retries errors marked with
+// microstorage.TransientError. Use it with backends which mark all their
+// temporary failures.
+func TransientIsRetryable(op string, err error) bool {
+	return microstorage.IsTransient(err)
+}
+
+func (s *Storage) Delete(ctx context.Context, key microstorage.K) error {
+	err := s.retry(ctx, OpDelete, key.Key(), func(ctx context.Context) error {
+		return s.underlying.Delete(ctx, key)
+	})
 	return microerror.Mask(err)
 }
 
 func (s *Storage) Exists(ctx context.Context, key microstorage.K) (bool, error) {
-	b := s.newBackOffFunc()
 	var exists bool
-	op := func() error {
+	err := s.retry(ctx, OpExists, key.Key(), func(ctx context.Context) error {
 		var err error
 		exists, err = s.underlying.Exists(ctx, key)
-		if microstorage.IsInvalidKey(err) || microstorage.IsNotFound(err) {
-			return backoff.Permanent(err)
-		}
 		return err
-	}
-	notify := func(err error, delay time.Duration) {
-		s.logger.Log("warning", "retrying", "op", "exists", "key", key, "delay", delay, "err", fmt.Sprintf("%#v", err))
-	}
-	err := backoff.RetryNotify(op, b, notify)
+	})
 	return exists, microerror.Mask(err)
 }
 
 func (s *Storage) List(ctx context.Context, key microstorage.K) ([]microstorage.KV, error) {
-	b := s.newBackOffFunc()
 	var list []microstorage.KV
-	op := func() error {
+	err := s.retry(ctx, OpList, key.Key(), func(ctx context.Context) error {
 		var err error
 		list, err = s.underlying.List(ctx, key)
-		if microstorage.IsInvalidKey(err) || microstorage.IsNotFound(err) {
-			return backoff.Permanent(err)
-		}
 		return err
-	}
-	notify := func(err error, delay time.Duration) {
-		s.logger.Log("warning", "retrying", "op", "list", "key", key, "delay", delay, "err", fmt.Sprintf("%#v", err))
-	}
-	err := backoff.RetryNotify(op, b, notify)
+	})
 	return list, microerror.Mask(err)
 }
 
 func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
-	b := s.newBackOffFunc()
-	op := func() error {
-		err := s.underlying.Put(ctx, kv)
-		if microstorage.IsInvalidKey(err) || microstorage.IsNotFound(err) {
-			return backoff.Permanent(err)
-		}
-		return err
-	}
-	notify := func(err error, delay time.Duration) {
-		s.logger.Log("warning", "retrying", "op", "put", "key", kv.Key, "delay", delay, "err", fmt.Sprintf("%#v", err))
-	}
-	err := backoff.RetryNotify(op, b, notify)
+	err := s.retry(ctx, OpPut, kv.Key(), func(ctx context.Context) error {
+		return s.underlying.Put(ctx, kv)
+	})
 	return microerror.Mask(err)
 }
 
 func (s *Storage) Search(ctx context.Context, key microstorage.K) (microstorage.KV, error) {
-	b := s.newBackOffFunc()
 	var value microstorage.KV
-	op := func() error {
+	err := s.retry(ctx, OpSearch, key.Key(), func(ctx context.Context) error {
 		var err error
 		value, err = s.underlying.Search(ctx, key)
-		if microstorage.IsInvalidKey(err) || microstorage.IsNotFound(err) {
+		return err
+	})
+	return value, microerror.Mask(err)
+}
+
+// Watch passes the call through to the underlying storage if it implements
+// microstorage.Watcher. Only establishing the watch is retried. The attempt
+// timeout does not apply because it would end the watch. Otherwise it fails
+// with microstorage.NotSupportedError.
+func (s *Storage) Watch(ctx context.Context, key microstorage.K) (<-chan microstorage.Event, error) {
+	w, ok := s.underlying.(microstorage.Watcher)
+	if !ok {
+		return nil, microerror.Maskf(microstorage.NotSupportedError, "%T does not implement microstorage.Watcher", s.underlying)
+	}
+
+	var ch <-chan microstorage.Event
+	err := s.retry(ctx, OpWatch, key.Key(), func(context.Context) error {
+		var err error
+		ch, err = w.Watch(ctx, key)
+		return err
+	})
+	return ch, microerror.Mask(err)
+}
+
+// retry calls f until it succeeds, fails with an error which is not
+// retryable, the backoff of the operation gives up or ctx is done. Every
+// attempt gets a context bounded by the attempt timeout.
+func (s *Storage) retry(ctx context.Context, op string, key string, f func(ctx context.Context) error) error {
+	b := cenkaltibackoff.WithContext(s.newBackOff(op), ctx)
+	o := func() error {
+		// Do not make another attempt when ctx is already done.
+		err := ctx.Err()
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+
+		err = s.attempt(ctx, f)
+		if err != nil && !s.isRetryable(op, err) {
 			return backoff.Permanent(err)
 		}
 		return err
 	}
 	notify := func(err error, delay time.Duration) {
-		s.logger.Log("warning", "retrying", "op", "search", "key", key, "delay", delay, "err", fmt.Sprintf("%#v", err))
+		s.logger.Log("warning", "retrying", "op", op, "key", key, "delay", delay, "err", fmt.Sprintf("%#v", err))
+	}
+	err := backoff.RetryNotify(o, b, notify)
+	return microerror.Mask(err)
+}
+
+func (s *Storage) attempt(ctx context.Context, f func(ctx context.Context) error) error {
+	if s.attemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.attemptTimeout)
+		defer cancel()
+	}
+
+	return f(ctx)
+}
+
+func (s *Storage) newBackOff(op string) backoff.Interface {
+	switch op {
+	case OpDelete, OpPut:
+		return s.newWriteBackOffFunc()
+	default:
+		return s.newReadBackOffFunc()
 	}
-	err := backoff.RetryNotify(op, b, notify)
-	return value, microerror.Mask(err)
 }
@@ -1,10 +1,17 @@
 package retrystorage
 
 import (
+	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/giantswarm/backoff"
+	"github.com/giantswarm/microerror"
 	"github.com/giantswarm/micrologger/microloggertest"
 
+	"github.com/giantswarm/microstorage"
 	"github.com/giantswarm/microstorage/memory"
 	"github.com/giantswarm/microstorage/storagetest"
 )
@@ -27,3 +34,298 @@ func TestRetryStorage(t *testing.T) {
 
 	storagetest.Test(t, storage)
 }
+
+// blockingStorage blocks every call until the context passed to it is done.
+type blockingStorage struct {
+	microstorage.Storage
+
+	calls int32
+}
+
+func (s *blockingStorage) block(ctx context.Context) error {
+	atomic.AddInt32(&s.calls, 1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *blockingStorage) Put(ctx context.Context, kv microstorage.KV) error {
+	return s.block(ctx)
+}
+
+func (s *blockingStorage) Search(ctx context.Context, key microstorage.K) (microstorage.KV, error) {
+	return microstorage.KV{}, s.block(ctx)
+}
+
+func Test_Storage_ContextCancel(t *testing.T) {
+	underlying := &blockingStorage{}
+
+	c := Config{
+		Logger:     microloggertest.New(),
+		Underlying: underlying,
+		NewBackOffFunc: func() backoff.Interface {
+			return backoff.NewMaxRetries(100, time.Hour)
+		},
+	}
+
+	storage, err := New(c)
+	if err != nil {
+		t.Fatalf("unexpected error %#v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "value")))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected", context.DeadlineExceeded, "got", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatal("expected", "return right after the deadline", "got", d)
+	}
+	if n := atomic.LoadInt32(&underlying.calls); n != 1 {
+		t.Fatal("expected", 1, "got", n)
+	}
+
+	// An already cancelled context must not reach the underlying storage.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	_, err = storage.Search(ctx, microstorage.MustK(microstorage.NewK("key")))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("expected", context.Canceled, "got", err)
+	}
+	if n := atomic.LoadInt32(&underlying.calls); n != 1 {
+		t.Fatal("expected", 1, "got", n)
+	}
+}
+
+func Test_Storage_CancelWhileWaiting(t *testing.T) {
+	underlying := &blockingStorage{}
+
+	c := Config{
+		Logger:     microloggertest.New(),
+		Underlying: underlying,
+		NewBackOffFunc: func() backoff.Interface {
+			return backoff.NewMaxRetries(100, time.Hour)
+		},
+		AttemptTimeout: 10 * time.Millisecond,
+	}
+
+	storage, err := New(c)
+	if err != nil {
+		t.Fatalf("unexpected error %#v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err = storage.Search(ctx, microstorage.MustK(microstorage.NewK("key")))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("expected", context.Canceled, "got", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatal("expected", "return right after cancellation", "got", d)
+	}
+}
+
+func Test_Storage_AttemptTimeout(t *testing.T) {
+	underlying := &blockingStorage{}
+
+	c := Config{
+		Logger:     microloggertest.New(),
+		Underlying: underlying,
+		NewBackOffFunc: func() backoff.Interface {
+			return backoff.NewMaxRetries(2, time.Millisecond)
+		},
+		AttemptTimeout: 10 * time.Millisecond,
+	}
+
+	storage, err := New(c)
+	if err != nil {
+		t.Fatalf("unexpected error %#v", err)
+	}
+
+	err = storage.Put(context.Background(), microstorage.MustKV(microstorage.NewKV("key", "value")))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected", context.DeadlineExceeded, "got", err)
+	}
+	if n := atomic.LoadInt32(&underlying.calls); n != 2 {
+		t.Fatal("expected", 2, "got", n)
+	}
+}
+
+// failingStorage fails every call with the configured error.
+type failingStorage struct {
+	microstorage.Storage
+
+	err   error
+	calls int32
+}
+
+func (s *failingStorage) Put(ctx context.Context, kv microstorage.KV) error {
+	atomic.AddInt32(&s.calls, 1)
+	return s.err
+}
+
+func (s *failingStorage) Search(ctx context.Context, key microstorage.K) (microstorage.KV, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return microstorage.KV{}, s.err
+}
+
+func Test_DefaultIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "case 0: unknown error",
+			err:      errors.New("connection refused"),
+			expected: true,
+		},
+		{
+			name:     "case 1: transient error",
+			err:      microerror.Maskf(microstorage.TransientError, "connection refused"),
+			expected: true,
+		},
+		{
+			name:     "case 2: invalid key",
+			err:      microerror.Mask(microstorage.InvalidKeyError),
+			expected: false,
+		},
+		{
+			name:     "case 3: not found",
+			err:      microerror.Mask(microstorage.NotFoundError),
+			expected: false,
+		},
+		{
+			name:     "case 4: not supported",
+			err:      microerror.Mask(microstorage.NotSupportedError),
+			expected: false,
+		},
+		{
+			name:     "case 5: conflict",
+			err:      microerror.Mask(microstorage.ConflictError),
+			expected: false,
+		},
+		{
+			name:     "case 6: read-only",
+			err:      microerror.Mask(microstorage.ReadOnlyError),
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retryable := DefaultIsRetryable(OpPut, tc.err)
+			if retryable != tc.expected {
+				t.Fatal("expected", tc.expected, "got", retryable)
+			}
+		})
+	}
+}
+
+func Test_Storage_IsRetryable(t *testing.T) {
+	testCases := []struct {
+		name          string
+		err           error
+		isRetryable   func(op string, err error) bool
+		expectedCalls int32
+	}{
+		{
+			name:          "case 0: default policy retries unknown errors",
+			err:           errors.New("connection refused"),
+			isRetryable:   nil,
+			expectedCalls: 3,
+		},
+		{
+			name:          "case 1: default policy does not retry not found",
+			err:           microerror.Mask(microstorage.NotFoundError),
+			isRetryable:   nil,
+			expectedCalls: 1,
+		},
+		{
+			name:          "case 2: transient policy retries transient errors",
+			err:           microerror.Maskf(microstorage.TransientError, "connection refused"),
+			isRetryable:   TransientIsRetryable,
+			expectedCalls: 3,
+		},
+		{
+			name:          "case 3: transient policy does not retry unknown errors",
+			err:           errors.New("permission denied"),
+			isRetryable:   TransientIsRetryable,
+			expectedCalls: 1,
+		},
+		{
+			name: "case 4: custom policy",
+			err:  errors.New("permission denied"),
+			isRetryable: func(op string, err error) bool {
+				return op != OpPut
+			},
+			expectedCalls: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			underlying := &failingStorage{err: tc.err}
+
+			c := Config{
+				Logger:     microloggertest.New(),
+				Underlying: underlying,
+				NewBackOffFunc: func() backoff.Interface {
+					return backoff.NewMaxRetries(3, time.Millisecond)
+				},
+				IsRetryable: tc.isRetryable,
+			}
+
+			storage, err := New(c)
+			if err != nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			err = storage.Put(context.Background(), microstorage.MustKV(microstorage.NewKV("key", "value")))
+			if microerror.Cause(err) != microerror.Cause(tc.err) {
+				t.Fatal("expected", tc.err, "got", err)
+			}
+			if n := atomic.LoadInt32(&underlying.calls); n != tc.expectedCalls {
+				t.Fatal("expected", tc.expectedCalls, "got", n)
+			}
+		})
+	}
+}
+
+func Test_Storage_ReadWriteBackOff(t *testing.T) {
+	underlying := &failingStorage{err: errors.New("connection refused")}
+
+	c := Config{
+		Logger:     microloggertest.New(),
+		Underlying: underlying,
+		NewReadBackOffFunc: func() backoff.Interface {
+			return backoff.NewMaxRetries(4, time.Millisecond)
+		},
+		NewWriteBackOffFunc: func() backoff.Interface {
+			return backoff.NewMaxRetries(2, time.Millisecond)
+		},
+	}
+
+	storage, err := New(c)
+	if err != nil {
+		t.Fatalf("unexpected error %#v", err)
+	}
+
+	_ = storage.Put(context.Background(), microstorage.MustKV(microstorage.NewKV("key", "value")))
+	if n := atomic.SwapInt32(&underlying.calls, 0); n != 2 {
+		t.Fatal("expected", 2, "got", n)
+	}
+
+	_, _ = storage.Search(context.Background(), microstorage.MustK(microstorage.NewK("key")))
+	if n := atomic.SwapInt32(&underlying.calls, 0); n != 4 {
+		t.Fatal("expected", 4, "got", n)
+	}
+}
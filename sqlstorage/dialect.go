@@ -0,0 +1,41 @@
+package sqlstorage
+
+import (
+	"fmt"
+)
+
+// Dialect selects the SQL flavour of the database.
+type Dialect string
+
+const (
+	// DialectSQLite is used for SQLite databases.
+	DialectSQLite Dialect = "sqlite"
+	// DialectPostgres is used for PostgreSQL databases.
+	DialectPostgres Dialect = "postgres"
+)
+
+// createTableQuery returns the statement creating the table when it does
+// not exist yet. Keys of PostgreSQL tables use the "C" collation so they are
+// compared byte-wise like in SQLite. Prefix listing relies on that.
+func (d Dialect) createTableQuery(table string) string {
+	switch d {
+	case DialectPostgres:
+		return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	key TEXT COLLATE "C" PRIMARY KEY,
+	value BYTEA NOT NULL,
+	revision BIGINT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`, table)
+	default:
+		return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	key TEXT PRIMARY KEY,
+	value BLOB NOT NULL,
+	revision INTEGER NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+)`, table)
+	}
+}
+
+func (d Dialect) valid() bool {
+	return d == DialectSQLite || d == DialectPostgres
+}
@@ -0,0 +1,21 @@
+package sqlstorage
+
+import "github.com/giantswarm/microerror"
+
+var invalidConfigError = &microerror.Error{
+	Kind: "invalidConfigError",
+}
+
+// IsInvalidConfig asserts invalidConfigError.
+func IsInvalidConfig(err error) bool {
+	return microerror.Cause(err) == invalidConfigError
+}
+
+var invalidLimitError = &microerror.Error{
+	Kind: "invalidLimitError",
+}
+
+// IsInvalidLimit asserts invalidLimitError.
+func IsInvalidLimit(err error) bool {
+	return microerror.Cause(err) == invalidLimitError
+}
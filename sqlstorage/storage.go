@@ -0,0 +1,237 @@
+// Package sqlstorage provides a storage implementation on top of a relational
+// database accessed through database/sql. SQLite and PostgreSQL are
+// supported.
+//
+// All values are stored in a single table with the following columns.
+//
+//	key         the sanitized key, e.g. "/a/b/c"
+//	value       the value
+//	revision    incremented on every update of the key, starting at 1
+//	updated_at  the time of the last update
+//
+// The table is created when it does not exist.
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/giantswarm/microerror"
+
+	"github.com/giantswarm/microstorage"
+)
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Config represents the configuration used to create a SQL backed storage.
+type Config struct {
+	// DB is the database handle. The caller is responsible for importing
+	// the driver and for closing the handle.
+	DB *sql.DB
+
+	// Dialect is the SQL flavour of the database.
+	Dialect Dialect
+	// Table is the name of the table the values are stored in.
+	Table string
+}
+
+// DefaultConfig provides a default configuration to create a new SQL backed
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		DB: nil, // Required.
+
+		Dialect: DialectSQLite,
+		Table:   "kv",
+	}
+}
+
+// New creates a new configured SQL storage. It creates the table when it does
+// not exist.
+func New(config Config) (*Storage, error) {
+	if config.DB == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.DB must not be empty", config)
+	}
+	if !config.Dialect.valid() {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Dialect must be one of %q or %q", config, DialectSQLite, DialectPostgres)
+	}
+	if !tableNameRegexp.MatchString(config.Table) {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Table must match %s", config, tableNameRegexp)
+	}
+
+	_, err := config.DB.ExecContext(context.Background(), config.Dialect.createTableQuery(config.Table))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	t := config.Table
+	storage := &Storage{
+		db: config.DB,
+
+		putQuery: fmt.Sprintf(`INSERT INTO %s (key, value, revision, updated_at) VALUES ($1, $2, 1, $3)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value, revision = %s.revision + 1, updated_at = excluded.updated_at`, t, t),
+		deleteQuery:   fmt.Sprintf(`DELETE FROM %s WHERE key = $1`, t),
+		existsQuery:   fmt.Sprintf(`SELECT 1 FROM %s WHERE key = $1`, t),
+		listQuery:     fmt.Sprintf(`SELECT key, value FROM %s WHERE key >= $1 AND key < $2`, t),
+		listRootQuery: fmt.Sprintf(`SELECT key, value FROM %s`, t),
+		listPageQuery: fmt.Sprintf(`SELECT key, value FROM %s WHERE key > $1 AND key < $2 ORDER BY key LIMIT $3`, t),
+		searchQuery:   fmt.Sprintf(`SELECT value FROM %s WHERE key = $1`, t),
+	}
+
+	return storage, nil
+}
+
+// Storage is the SQL backed storage.
+type Storage struct {
+	// Dependencies.
+
+	db *sql.DB
+
+	// Internals.
+
+	putQuery      string
+	deleteQuery   string
+	existsQuery   string
+	listQuery     string
+	listRootQuery string
+	listPageQuery string
+	searchQuery   string
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	_, err := s.db.ExecContext(ctx, s.putQuery, kv.Key(), []byte(kv.Val()), time.Now().UTC())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	_, err := s.db.ExecContext(ctx, s.deleteQuery, k.Key())
+	if err != nil {
+		return microerror.Mask(err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	var one int
+	err := s.db.QueryRowContext(ctx, s.existsQuery, k.Key()).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, microerror.Mask(err)
+	}
+
+	return true, nil
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	key := k.Key()
+
+	var rows *sql.Rows
+	var err error
+	if key == "/" {
+		rows, err = s.db.QueryContext(ctx, s.listRootQuery)
+	} else {
+		// All keys nested under the listed key fall into the range
+		// ["<key>/", "<key>0") because '0' directly follows '/' in
+		// byte order. This way keys which are not separated by slash
+		// are ignored. When there is a key stored like "foo/bar/baz",
+		// listing keys using "foo/ba" should not succeed.
+		rows, err = s.db.QueryContext(ctx, s.listQuery, key+"/", key+"0")
+	}
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	defer rows.Close()
+
+	i := len(key)
+	if key == "/" {
+		i = 0
+	}
+
+	list, err := scanList(rows, i)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return list, nil
+}
+
+func (s *Storage) ListPage(ctx context.Context, k microstorage.K, after string, limit int) ([]microstorage.KV, error) {
+	if limit <= 0 {
+		return nil, microerror.Maskf(invalidLimitError, "limit must be positive, got %d", limit)
+	}
+
+	prefix := k.Key()
+	if prefix == "/" {
+		prefix = ""
+	}
+
+	// Same range as in List. All keys start with a slash, so the range
+	// ("/", "0") covers all keys when listing the root key. No key ends
+	// with a slash, so the lower bound can be exclusive for the first page
+	// too.
+	lower := prefix + "/"
+	if after != "" {
+		lower = prefix + after
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.listPageQuery, lower, prefix+"0", limit)
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+	defer rows.Close()
+
+	list, err := scanList(rows, len(prefix))
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return list, nil
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	key := k.Key()
+
+	var v []byte
+	err := s.db.QueryRowContext(ctx, s.searchQuery, key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return microstorage.KV{}, microerror.Maskf(microstorage.NotFoundError, "key=%s", key)
+	} else if err != nil {
+		return microstorage.KV{}, microerror.Mask(err)
+	}
+
+	return microstorage.MustKV(microstorage.NewKV(key, string(v))), nil
+}
+
+// scanList reads the listed KVs. Keys are made relative by cutting the first
+// i+1 bytes, i.e. the listed key and the separating slash.
+func scanList(rows *sql.Rows, i int) ([]microstorage.KV, error) {
+	var list []microstorage.KV
+	for rows.Next() {
+		var k string
+		var v []byte
+		err := rows.Scan(&k, &v)
+		if err != nil {
+			return nil, microerror.Mask(err)
+		}
+
+		k = k[i+1:]
+		list = append(list, microstorage.MustKV(microstorage.NewKV(k, string(v))))
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, microerror.Mask(err)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,72 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+func Test_Storage(t *testing.T) {
+	config := DefaultConfig()
+	config.DB = newTestDB(t)
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	storagetest.Test(t, storage)
+}
+
+func Test_Storage_Revision(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	config := DefaultConfig()
+	config.DB = db
+	config.Table = "revisions"
+
+	storage, err := New(config)
+	require.NoError(t, err)
+
+	// Creating the storage again must not fail on the existing table.
+	storage, err = New(config)
+	require.NoError(t, err)
+
+	kv := microstorage.MustKV(microstorage.NewKV("revision/key", "value"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, storage.Put(ctx, kv))
+	}
+
+	var revision int64
+	err = db.QueryRowContext(ctx, `SELECT revision FROM revisions WHERE key = $1`, kv.Key()).Scan(&revision)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), revision)
+}
+
+func Test_New_InvalidTable(t *testing.T) {
+	config := DefaultConfig()
+	config.DB = newTestDB(t)
+	config.Table = "kv; DROP TABLE kv"
+
+	_, err := New(config)
+	require.True(t, IsInvalidConfig(err))
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
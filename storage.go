@@ -4,6 +4,7 @@ package microstorage
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/giantswarm/microerror"
 )
@@ -92,6 +93,18 @@ func NewKV(key, val string) (KV, error) {
 	return kv, nil
 }
 
+// NewKVBytes creates a new immutable key-value pair holding a binary value.
+// The value is copied, so val can be modified afterwards. See NewKV for
+// details.
+func NewKVBytes(key string, val []byte) (KV, error) {
+	kv, err := NewKV(key, string(val))
+	if err != nil {
+		return KV{}, microerror.Mask(err)
+	}
+
+	return kv, nil
+}
+
 // MustKV is a helper that wraps a call to a function returning (KV, error) and
 // panics if the error is non-nil. It is intended for use in Storage
 // implementations, where the key is known to be valid because it is retrieved
@@ -125,6 +138,11 @@ func (k KV) Val() string {
 	return k.val
 }
 
+// Bytes returns a copy of the value associated with this key-value pair.
+func (k KV) Bytes() []byte {
+	return []byte(k.val)
+}
+
 // Storage represents the abstraction for underlying storage backends.
 type Storage interface {
 	// Put stores the given value under the given key. If the value
@@ -141,3 +159,96 @@ type Storage interface {
 	// Search does a lookup for the value stored under key and returns it, if any.
 	Search(ctx context.Context, key K) (KV, error)
 }
+
+// EventType describes the kind of change a watch Event reports.
+type EventType int
+
+const (
+	// EventPut is reported when a value is created or overridden.
+	EventPut EventType = iota
+	// EventDelete is reported when a value is removed.
+	EventDelete
+)
+
+// String returns the human readable representation of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+// Event is a single change notification emitted by a Watcher.
+type Event struct {
+	// Type is the kind of the change.
+	Type EventType
+	// KV holds the changed key with its absolute path. For EventPut the value
+	// is the newly stored one. For EventDelete the value is empty.
+	KV KV
+}
+
+// Watcher is an optional interface implemented by Storage backends capable of
+// notifying about changes. Use a type assertion to check whether a Storage
+// may support it.
+//
+// Storages wrapping another Storage implement Watcher regardless of the
+// wrapped one and fail with NotSupportedError when it can not watch. Callers
+// must therefore check the error with IsNotSupported, even after the type
+// assertion succeeded.
+type Watcher interface {
+	// Watch emits an Event for every change of the value stored under the
+	// given key or under any key nested below it. Watching RootKey emits
+	// events for all keys. Only changes made after Watch returns are
+	// reported. The returned channel is closed when ctx is done. It fails
+	// with NotSupportedError when the Storage can not watch after all.
+	Watch(ctx context.Context, key K) (<-chan Event, error)
+}
+
+// RevisionStorage is an optional interface implemented by Storage backends
+// supporting optimistic concurrency control. Every modification of a value
+// assigns it a new revision. Revisions of a single key grow monotonically.
+// Use a type assertion to check whether a Storage supports it.
+type RevisionStorage interface {
+	// SearchWithRevision does a lookup for the value stored under key and
+	// returns it together with its current revision.
+	SearchWithRevision(ctx context.Context, key K) (KV, int64, error)
+	// PutIfRevision stores the given value only if the revision of the value
+	// currently stored under the key equals rev. It returns the new revision
+	// on success and fails with ConflictError otherwise. This also includes
+	// the case when the value does not exist.
+	PutIfRevision(ctx context.Context, kv KV, rev int64) (int64, error)
+	// PutIfAbsent stores the given value only if there is no value stored
+	// under the key yet. It returns the new revision on success and fails
+	// with ConflictError otherwise.
+	PutIfAbsent(ctx context.Context, kv KV) (int64, error)
+	// DeleteIfRevision removes the value stored under the given key only if
+	// its revision equals rev. It fails with ConflictError otherwise. This
+	// also includes the case when the value does not exist.
+	DeleteIfRevision(ctx context.Context, key K, rev int64) error
+}
+
+// TTLStorage is an optional interface implemented by Storage backends able to
+// expire values. Use a type assertion to check whether a Storage supports it.
+type TTLStorage interface {
+	// PutWithTTL stores the given value under the given key like Put does,
+	// and removes it once the given ttl elapses. The ttl must be positive.
+	// Storing the value again with Put makes it persistent again.
+	PutWithTTL(ctx context.Context, kv KV, ttl time.Duration) error
+}
+
+// PagingStorage is an optional interface implemented by Storage backends able
+// to list keys page by page, so large storages do not have to be held in
+// memory at once. Use a type assertion to check whether a Storage supports
+// it.
+type PagingStorage interface {
+	// ListPage works like List, but returns at most limit KVs sorted by
+	// key, and only the ones with a key greater than after. The first page
+	// is listed with an empty after, following pages with the key of the
+	// last KV of the previous page. An empty page marks the end. The limit
+	// must be positive.
+	ListPage(ctx context.Context, key K, after string, limit int) ([]KV, error)
+}
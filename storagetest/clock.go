@@ -0,0 +1,38 @@
+package storagetest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a manually advanced clock. It allows Storage implementations
+// supporting microstorage.TTLStorage to be tested deterministically. Pass
+// Clock.Now to the implementation's configuration and use Clock.Add to move
+// time forward.
+type Clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewClock creates a new Clock starting at a fixed point in time.
+func NewClock() *Clock {
+	return &Clock{
+		now: time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// Add moves the clock forward by d.
+func (c *Clock) Add(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,6 +25,26 @@ func Test(t *testing.T, storage microstorage.Storage) {
 	testListEmpty(t, storage)
 	testListNested(t, storage)
 	testListInvalid(t, storage)
+
+	if w, ok := storage.(microstorage.Watcher); ok {
+		testWatch(t, storage, w)
+	}
+	if r, ok := storage.(microstorage.RevisionStorage); ok {
+		testPutIfAbsent(t, storage, r)
+		testPutIfRevision(t, storage, r)
+		testDeleteIfRevision(t, storage, r)
+	}
+	if x, ok := storage.(microstorage.TxnStorage); ok {
+		testTxnThen(t, storage, x)
+		testTxnElse(t, storage, x)
+		testTxnConcurrent(t, storage, x)
+	}
+	if b, ok := storage.(microstorage.BytesStorage); ok {
+		testBytes(t, storage, b)
+	}
+	if p, ok := storage.(microstorage.PagingStorage); ok {
+		testListPage(t, storage, p)
+	}
 }
 
 func testBasicCRUD(t *testing.T, storage microstorage.Storage) {
@@ -254,6 +275,300 @@ func testListInvalid(t *testing.T, storage microstorage.Storage) {
 	}
 }
 
+func testWatch(t *testing.T, storage microstorage.Storage, watcher microstorage.Watcher) {
+	var (
+		name = "testWatch"
+
+		baseKey = name + "-key"   //nolint:goconst
+		value   = name + "-value" //nolint:goconst
+	)
+
+	for _, key0 := range validKeyVariations(baseKey) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		k0 := microstorage.MustK(microstorage.NewK(key0))
+		kv1 := microstorage.MustKV(microstorage.NewKV(path.Join(key0, "one"), value))
+		kv2 := microstorage.MustKV(microstorage.NewKV(k0.Key()+"-sibling", value))
+
+		events, err := watcher.Watch(ctx, k0)
+		if microstorage.IsNotSupported(err) {
+			// Wrapped storages implement Watcher even when the
+			// storage they wrap can not watch.
+			cancel()
+			return
+		}
+		require.NoError(t, err, "%s: key=%s", name, k0.Key())
+
+		err = storage.Put(ctx, kv1)
+		require.NoError(t, err, "%s: kv=%#v", name, kv1)
+
+		// kv2 shares the prefix with k0 but is not nested under it so it
+		// must not be reported.
+		err = storage.Put(ctx, kv2)
+		require.NoError(t, err, "%s: kv=%#v", name, kv2)
+
+		err = storage.Delete(ctx, kv1.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv1)
+
+		e := receiveEvent(t, events)
+		assert.Equal(t, microstorage.EventPut, e.Type, "%s: key=%s", name, k0.Key())
+		assert.Equal(t, kv1, e.KV, "%s: key=%s", name, k0.Key())
+
+		e = receiveEvent(t, events)
+		assert.Equal(t, microstorage.EventDelete, e.Type, "%s: key=%s", name, k0.Key())
+		assert.Equal(t, kv1.Key(), e.KV.Key(), "%s: key=%s", name, k0.Key())
+
+		cancel()
+
+		// Make sure the channel gets closed after the context is
+		// cancelled.
+		for range events {
+		}
+	}
+}
+
+func testBytes(t *testing.T, storage microstorage.Storage, bytesStorage microstorage.BytesStorage) {
+	var (
+		name = "testBytes"
+
+		ctx = context.TODO()
+
+		baseKey = name + "-key" //nolint:goconst
+	)
+
+	for _, key := range validKeyVariations(baseKey) {
+		parent := microstorage.MustK(microstorage.NewK(key))
+		k := microstorage.MustK(microstorage.NewK(path.Join(key, "binary")))
+		// Not valid UTF-8.
+		value := []byte{0x00, 0xff, 0xfe, 0x80, '\n', 0x00}
+		expected := append([]byte(nil), value...)
+
+		err := bytesStorage.PutBytes(ctx, k, value)
+		require.NoError(t, err, "%s: key=%s", name, key)
+
+		// Modifying the value after it is stored must not change the
+		// stored value.
+		value[0] = 0x01
+
+		got, err := bytesStorage.SearchBytes(ctx, k)
+		require.NoError(t, err, "%s: key=%s", name, key)
+		require.Equal(t, expected, got, "%s: key=%s", name, key)
+
+		got[0] = 0x01
+
+		got, err = bytesStorage.SearchBytes(ctx, k)
+		require.NoError(t, err, "%s: key=%s", name, key)
+		require.Equal(t, expected, got, "%s: key=%s", name, key)
+
+		kv, err := storage.Search(ctx, k)
+		require.NoError(t, err, "%s: key=%s", name, key)
+		require.Equal(t, expected, kv.Bytes(), "%s: key=%s", name, key)
+
+		list, err := bytesStorage.List(ctx, parent)
+		require.NoError(t, err, "%s: key=%s", name, key)
+		require.Len(t, list, 1, "%s: key=%s", name, key)
+		require.Equal(t, expected, list[0].Bytes(), "%s: key=%s", name, key)
+
+		err = bytesStorage.Delete(ctx, k)
+		require.NoError(t, err, "%s: key=%s", name, key)
+
+		_, err = bytesStorage.SearchBytes(ctx, k)
+		require.True(t, microstorage.IsNotFound(err), "%s: key=%s expected IsNotFoundError", name, key)
+	}
+}
+
+func testListPage(t *testing.T, storage microstorage.Storage, pagingStorage microstorage.PagingStorage) {
+	var (
+		name = "testListPage"
+
+		ctx = context.TODO()
+
+		baseKey = name + "-key"   //nolint:goconst
+		value   = name + "-value" //nolint:goconst
+	)
+
+	// listPages collects all pages and checks they are sorted and do not
+	// exceed the limit.
+	listPages := func(k microstorage.K, limit int) []microstorage.KV {
+		var all []microstorage.KV
+		after := ""
+		for {
+			page, err := pagingStorage.ListPage(ctx, k, after, limit)
+			require.NoError(t, err, "%s: key=%s after=%s", name, k.Key(), after)
+			require.LessOrEqual(t, len(page), limit, "%s: key=%s after=%s", name, k.Key(), after)
+			if len(page) == 0 {
+				return all
+			}
+
+			for _, kv := range page {
+				require.Greater(t, kv.Key(), after, "%s: key=%s", name, k.Key())
+				after = kv.Key()
+			}
+			all = append(all, page...)
+		}
+	}
+
+	for _, key := range validKeyVariations(baseKey) {
+		parent := microstorage.MustK(microstorage.NewK(key))
+		for _, k := range []string{"e", "a", "c", "c/nested", "b", "d"} {
+			err := storage.Put(ctx, microstorage.MustKV(microstorage.NewKV(path.Join(key, k), value)))
+			require.NoError(t, err, "%s: key=%s", name, key)
+		}
+		// Keys not separated by slash are not listed.
+		err := storage.Put(ctx, microstorage.MustKV(microstorage.NewKV(parent.Key()+"x/one", value)))
+		require.NoError(t, err, "%s: key=%s", name, key)
+
+		for _, k := range []microstorage.K{parent, microstorage.RootKey} {
+			expected, err := storage.List(ctx, k)
+			require.NoError(t, err, "%s: key=%s", name, k.Key())
+			sort.Sort(kvSlice(expected))
+
+			for _, limit := range []int{1, 2, len(expected) + 1} {
+				got := listPages(k, limit)
+				require.Equal(t, expected, got, "%s: key=%s limit=%d", name, k.Key(), limit)
+			}
+		}
+
+		_, err = pagingStorage.ListPage(ctx, parent, "", 0)
+		require.Error(t, err, "%s: key=%s", name, key)
+	}
+}
+
+func testPutIfAbsent(t *testing.T, storage microstorage.Storage, revStorage microstorage.RevisionStorage) {
+	var (
+		name = "testPutIfAbsent"
+
+		ctx = context.TODO()
+
+		baseKey        = name + "-key"   //nolint:goconst
+		value          = name + "-value" //nolint:goconst
+		overridenValue = name + "-overriden-value"
+	)
+
+	for _, key := range validKeyVariations(baseKey) {
+		kv := microstorage.MustKV(microstorage.NewKV(key, value))
+
+		rev, err := revStorage.PutIfAbsent(ctx, kv)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		gotKV, gotRev, err := revStorage.SearchWithRevision(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+		require.Equal(t, kv, gotKV, "%s: kv=%#v", name, kv)
+		require.Equal(t, rev, gotRev, "%s: kv=%#v", name, kv)
+
+		overridenKV := microstorage.MustKV(microstorage.NewKV(kv.Key(), overridenValue))
+		_, err = revStorage.PutIfAbsent(ctx, overridenKV)
+		require.True(t, microstorage.IsConflict(err), "%s: kv=%#v expected ConflictError", name, overridenKV)
+
+		gotKV, err = storage.Search(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+		require.Equal(t, kv, gotKV, "%s: kv=%#v", name, kv)
+	}
+}
+
+func testPutIfRevision(t *testing.T, storage microstorage.Storage, revStorage microstorage.RevisionStorage) {
+	var (
+		name = "testPutIfRevision"
+
+		ctx = context.TODO()
+
+		baseKey        = name + "-key"   //nolint:goconst
+		value          = name + "-value" //nolint:goconst
+		overridenValue = name + "-overriden-value"
+	)
+
+	for _, key := range validKeyVariations(baseKey) {
+		kv := microstorage.MustKV(microstorage.NewKV(key, value))
+		overridenKV := microstorage.MustKV(microstorage.NewKV(kv.Key(), overridenValue))
+
+		// Conditional Put of a not existing value must fail.
+		_, err := revStorage.PutIfRevision(ctx, kv, 0)
+		require.True(t, microstorage.IsConflict(err), "%s: kv=%#v expected ConflictError", name, kv)
+
+		err = storage.Put(ctx, kv)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		_, rev, err := revStorage.SearchWithRevision(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		newRev, err := revStorage.PutIfRevision(ctx, overridenKV, rev)
+		require.NoError(t, err, "%s: kv=%#v", name, overridenKV)
+		require.Greater(t, newRev, rev, "%s: kv=%#v", name, overridenKV)
+
+		// Stale revision must be rejected.
+		_, err = revStorage.PutIfRevision(ctx, kv, rev)
+		require.True(t, microstorage.IsConflict(err), "%s: kv=%#v expected ConflictError", name, kv)
+
+		gotKV, gotRev, err := revStorage.SearchWithRevision(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, overridenKV)
+		require.Equal(t, overridenKV, gotKV, "%s: kv=%#v", name, overridenKV)
+		require.Equal(t, newRev, gotRev, "%s: kv=%#v", name, overridenKV)
+
+		// Unconditional Put must change the revision as well.
+		err = storage.Put(ctx, kv)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		_, err = revStorage.PutIfRevision(ctx, overridenKV, newRev)
+		require.True(t, microstorage.IsConflict(err), "%s: kv=%#v expected ConflictError", name, overridenKV)
+	}
+}
+
+func testDeleteIfRevision(t *testing.T, storage microstorage.Storage, revStorage microstorage.RevisionStorage) {
+	var (
+		name = "testDeleteIfRevision"
+
+		ctx = context.TODO()
+
+		baseKey        = name + "-key"   //nolint:goconst
+		value          = name + "-value" //nolint:goconst
+		overridenValue = name + "-overriden-value"
+	)
+
+	for _, key := range validKeyVariations(baseKey) {
+		kv := microstorage.MustKV(microstorage.NewKV(key, value))
+		overridenKV := microstorage.MustKV(microstorage.NewKV(kv.Key(), overridenValue))
+
+		// Conditional Delete of a not existing value must fail.
+		err := revStorage.DeleteIfRevision(ctx, kv.K(), 0)
+		require.True(t, microstorage.IsConflict(err), "%s: kv=%#v expected ConflictError", name, kv)
+
+		rev, err := revStorage.PutIfAbsent(ctx, kv)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		newRev, err := revStorage.PutIfRevision(ctx, overridenKV, rev)
+		require.NoError(t, err, "%s: kv=%#v", name, overridenKV)
+
+		// Stale revision must be rejected.
+		err = revStorage.DeleteIfRevision(ctx, kv.K(), rev)
+		require.True(t, microstorage.IsConflict(err), "%s: kv=%#v expected ConflictError", name, kv)
+
+		ok, err := storage.Exists(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+		require.True(t, ok, "%s: kv=%#v", name, kv)
+
+		err = revStorage.DeleteIfRevision(ctx, kv.K(), newRev)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		ok, err = storage.Exists(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+		require.False(t, ok, "%s: kv=%#v", name, kv)
+	}
+}
+
+func receiveEvent(t *testing.T, events <-chan microstorage.Event) microstorage.Event {
+	t.Helper()
+
+	select {
+	case e, ok := <-events:
+		require.True(t, ok, "expected event, got closed channel")
+		return e
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for event")
+	}
+
+	return microstorage.Event{}
+}
+
 var validKeyVariationsIDGen int64
 
 func validKeyVariations(key string) []string {
@@ -0,0 +1,94 @@
+package storagetest
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/giantswarm/microstorage"
+)
+
+// TestTTL is microstorage.TTLStorage conformance test. The storage must use
+// the given clock to determine the current time.
+func TestTTL(t *testing.T, storage microstorage.Storage, clock *Clock) {
+	ttlStorage, ok := storage.(microstorage.TTLStorage)
+	if !ok {
+		t.Fatalf("%T does not implement microstorage.TTLStorage", storage)
+	}
+
+	testPutWithTTLExpires(t, storage, ttlStorage, clock)
+	testPutWithTTLPersist(t, storage, ttlStorage, clock)
+}
+
+func testPutWithTTLExpires(t *testing.T, storage microstorage.Storage, ttlStorage microstorage.TTLStorage, clock *Clock) {
+	var (
+		name = "testPutWithTTLExpires"
+
+		ctx = context.TODO()
+
+		baseKey = name + "-key"   //nolint:goconst
+		value   = name + "-value" //nolint:goconst
+
+		ttl = time.Minute
+	)
+
+	for _, key := range validKeyVariations(baseKey) {
+		kv := microstorage.MustKV(microstorage.NewKV(path.Join(key, "ephemeral"), value))
+		k0 := microstorage.MustK(microstorage.NewK(key))
+
+		err := ttlStorage.PutWithTTL(ctx, kv, ttl)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		clock.Add(ttl - time.Second)
+
+		gotKV, err := storage.Search(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+		require.Equal(t, kv, gotKV, "%s: kv=%#v", name, kv)
+
+		clock.Add(time.Second)
+
+		ok, err := storage.Exists(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+		require.False(t, ok, "%s: kv=%#v", name, kv)
+
+		_, err = storage.Search(ctx, kv.K())
+		require.True(t, microstorage.IsNotFound(err), "%s: kv=%#v expected IsNotFoundError", name, kv)
+
+		list, err := storage.List(ctx, k0)
+		require.NoError(t, err, "%s: key=%s", name, k0.Key())
+		require.Empty(t, list, "%s: key=%s", name, k0.Key())
+	}
+}
+
+func testPutWithTTLPersist(t *testing.T, storage microstorage.Storage, ttlStorage microstorage.TTLStorage, clock *Clock) {
+	var (
+		name = "testPutWithTTLPersist"
+
+		ctx = context.TODO()
+
+		baseKey = name + "-key"   //nolint:goconst
+		value   = name + "-value" //nolint:goconst
+
+		ttl = time.Minute
+	)
+
+	for _, key := range validKeyVariations(baseKey) {
+		kv := microstorage.MustKV(microstorage.NewKV(key, value))
+
+		err := ttlStorage.PutWithTTL(ctx, kv, ttl)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		// Put without TTL must make the value persistent.
+		err = storage.Put(ctx, kv)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		clock.Add(2 * ttl)
+
+		gotKV, err := storage.Search(ctx, kv.K())
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+		require.Equal(t, kv, gotKV, "%s: kv=%#v", name, kv)
+	}
+}
@@ -0,0 +1,198 @@
+package storagetest
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/giantswarm/microstorage"
+)
+
+func testTxnThen(t *testing.T, storage microstorage.Storage, txnStorage microstorage.TxnStorage) {
+	var (
+		name = "testTxnThen"
+
+		ctx = context.TODO()
+
+		baseKey = name + "-key"   //nolint:goconst
+		value   = name + "-value" //nolint:goconst
+	)
+
+	for _, key := range validKeyVariations(baseKey) {
+		kv := microstorage.MustKV(microstorage.NewKV(path.Join(key, "resource"), value))
+		indexKV := microstorage.MustKV(microstorage.NewKV(path.Join(key, "index"), value))
+		staleKV := microstorage.MustKV(microstorage.NewKV(path.Join(key, "stale"), value))
+		elseKV := microstorage.MustKV(microstorage.NewKV(path.Join(key, "else"), value))
+
+		err := storage.Put(ctx, staleKV)
+		require.NoError(t, err, "%s: kv=%#v", name, staleKV)
+
+		txn := microstorage.NewTxn().
+			If(
+				microstorage.NewCmpNotExists(kv.K()),
+				microstorage.NewCmpExists(staleKV.K()),
+				microstorage.NewCmpValue(staleKV.K(), value),
+			).
+			Then(
+				microstorage.NewOpPut(kv),
+				microstorage.NewOpPut(indexKV),
+				microstorage.NewOpDelete(staleKV.K()),
+			).
+			Else(
+				microstorage.NewOpPut(elseKV),
+			)
+
+		res, err := txnStorage.Txn(ctx, txn)
+		require.NoError(t, err, "%s: key=%s", name, key)
+		require.True(t, res.Succeeded, "%s: key=%s", name, key)
+
+		for _, want := range []microstorage.KV{kv, indexKV} {
+			gotKV, err := storage.Search(ctx, want.K())
+			require.NoError(t, err, "%s: kv=%#v", name, want)
+			require.Equal(t, want, gotKV, "%s: kv=%#v", name, want)
+		}
+
+		for _, k := range []microstorage.K{staleKV.K(), elseKV.K()} {
+			ok, err := storage.Exists(ctx, k)
+			require.NoError(t, err, "%s: key=%s", name, k.Key())
+			require.False(t, ok, "%s: key=%s", name, k.Key())
+		}
+	}
+}
+
+func testTxnElse(t *testing.T, storage microstorage.Storage, txnStorage microstorage.TxnStorage) {
+	var (
+		name = "testTxnElse"
+
+		ctx = context.TODO()
+
+		baseKey        = name + "-key"   //nolint:goconst
+		value          = name + "-value" //nolint:goconst
+		overridenValue = name + "-overriden-value"
+	)
+
+	for _, key := range validKeyVariations(baseKey) {
+		kv := microstorage.MustKV(microstorage.NewKV(path.Join(key, "resource"), value))
+		indexKV := microstorage.MustKV(microstorage.NewKV(path.Join(key, "index"), value))
+		elseKV := microstorage.MustKV(microstorage.NewKV(path.Join(key, "else"), value))
+
+		err := storage.Put(ctx, kv)
+		require.NoError(t, err, "%s: kv=%#v", name, kv)
+
+		// The first condition succeeds but the second does not, so
+		// nothing from the Then branch may be applied.
+		txn := microstorage.NewTxn().
+			If(
+				microstorage.NewCmpExists(kv.K()),
+				microstorage.NewCmpValue(kv.K(), overridenValue),
+			).
+			Then(
+				microstorage.NewOpPut(indexKV),
+				microstorage.NewOpDelete(kv.K()),
+			).
+			Else(
+				microstorage.NewOpPut(elseKV),
+			)
+
+		res, err := txnStorage.Txn(ctx, txn)
+		require.NoError(t, err, "%s: key=%s", name, key)
+		require.False(t, res.Succeeded, "%s: key=%s", name, key)
+
+		for _, want := range []microstorage.KV{kv, elseKV} {
+			gotKV, err := storage.Search(ctx, want.K())
+			require.NoError(t, err, "%s: kv=%#v", name, want)
+			require.Equal(t, want, gotKV, "%s: kv=%#v", name, want)
+		}
+
+		ok, err := storage.Exists(ctx, indexKV.K())
+		require.NoError(t, err, "%s: kv=%#v", name, indexKV)
+		require.False(t, ok, "%s: kv=%#v", name, indexKV)
+	}
+}
+
+// testTxnConcurrent increments a counter from concurrent writers using
+// compare-and-swap transactions. Every successful increment also creates an
+// index entry in the same transaction. Lost updates or partially applied
+// transactions show up as a mismatch between the counter and the index.
+func testTxnConcurrent(t *testing.T, storage microstorage.Storage, txnStorage microstorage.TxnStorage) {
+	var (
+		name = "testTxnConcurrent"
+
+		ctx = context.TODO()
+
+		baseKey = name + "-key" //nolint:goconst
+
+		writers    = 8
+		increments = 25
+	)
+
+	key := validKeyVariations(baseKey)[0]
+	counterK := microstorage.MustK(microstorage.NewK(path.Join(key, "counter")))
+	indexK := microstorage.MustK(microstorage.NewK(path.Join(key, "index")))
+
+	err := storage.Put(ctx, microstorage.MustKV(microstorage.NewKV(counterK.Key(), "0")))
+	require.NoError(t, err, "%s: key=%s", name, counterK.Key())
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, writers)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < increments; {
+				kv, err := storage.Search(ctx, counterK)
+				if err != nil {
+					errCh <- err
+					return
+				}
+
+				n, err := strconv.Atoi(kv.Val())
+				if err != nil {
+					errCh <- err
+					return
+				}
+
+				next := strconv.Itoa(n + 1)
+				txn := microstorage.NewTxn().
+					If(microstorage.NewCmpValue(counterK, kv.Val())).
+					Then(
+						microstorage.NewOpPut(microstorage.MustKV(microstorage.NewKV(counterK.Key(), next))),
+						microstorage.NewOpPut(microstorage.MustKV(microstorage.NewKV(path.Join(indexK.Key(), next), next))),
+					)
+
+				res, err := txnStorage.Txn(ctx, txn)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if res.Succeeded {
+					i++
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(t, err, "%s: key=%s", name, key)
+	}
+
+	want := writers * increments
+
+	kv, err := storage.Search(ctx, counterK)
+	require.NoError(t, err, "%s: key=%s", name, counterK.Key())
+	assert.Equal(t, strconv.Itoa(want), kv.Val(), "%s: key=%s", name, counterK.Key())
+
+	list, err := storage.List(ctx, indexK)
+	require.NoError(t, err, "%s: key=%s", name, indexK.Key())
+	assert.Len(t, list, want, "%s: key=%s", name, indexK.Key())
+}
@@ -0,0 +1,170 @@
+// Package tracestorage provides a storage implementation starting an
+// OpenTelemetry span for every operation of an underlying storage.
+//
+// The span is a child of the span found in the context passed by the caller
+// and is passed on to the underlying storage through the context, so spans
+// started by the underlying storage, e.g. by instrumented clients, are nested
+// below it.
+package tracestorage
+
+import (
+	"context"
+
+	"github.com/giantswarm/microerror"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/giantswarm/microstorage"
+)
+
+const (
+	tracerName = "github.com/giantswarm/microstorage/tracestorage"
+
+	putSpanName    = "microstorage.Put"
+	deleteSpanName = "microstorage.Delete"
+	existsSpanName = "microstorage.Exists"
+	listSpanName   = "microstorage.List"
+	searchSpanName = "microstorage.Search"
+)
+
+// Attribute keys set on spans.
+const (
+	// KeyAttribute is the sanitized key of the operation.
+	KeyAttribute = attribute.Key("microstorage.key")
+	// ValueSizeAttribute is the size in bytes of the value written by Put
+	// or found by Search.
+	ValueSizeAttribute = attribute.Key("microstorage.value.size")
+	// ResultCountAttribute is the number of values returned by List.
+	ResultCountAttribute = attribute.Key("microstorage.result.count")
+	// FoundAttribute tells whether Exists or Search found the key.
+	FoundAttribute = attribute.Key("microstorage.found")
+)
+
+// Config represents the configuration used to create a tracing storage.
+type Config struct {
+	// Underlying is the storage operations are traced for.
+	Underlying microstorage.Storage
+
+	// TracerProvider provides the tracer spans are started with. It
+	// defaults to the global tracer provider.
+	TracerProvider trace.TracerProvider
+}
+
+// DefaultConfig provides a default configuration to create a new tracing
+// storage by best effort.
+func DefaultConfig() Config {
+	return Config{
+		Underlying: nil, // Required.
+
+		TracerProvider: otel.GetTracerProvider(),
+	}
+}
+
+// New creates a new configured tracing storage.
+func New(config Config) (*Storage, error) {
+	if config.Underlying == nil {
+		return nil, microerror.Maskf(invalidConfigError, "%T.Underlying must not be empty", config)
+	}
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+
+	s := &Storage{
+		underlying: config.Underlying,
+
+		tracer: config.TracerProvider.Tracer(tracerName),
+	}
+
+	return s, nil
+}
+
+// Storage is the tracing storage.
+type Storage struct {
+	// Dependencies.
+
+	underlying microstorage.Storage
+
+	// Internals.
+
+	tracer trace.Tracer
+}
+
+func (s *Storage) Put(ctx context.Context, kv microstorage.KV) error {
+	ctx, span := s.start(ctx, putSpanName, kv.Key())
+	defer span.End()
+
+	span.SetAttributes(ValueSizeAttribute.Int(len(kv.Val())))
+
+	err := s.underlying.Put(ctx, kv)
+	recordError(span, err)
+
+	return err
+}
+
+func (s *Storage) Delete(ctx context.Context, k microstorage.K) error {
+	ctx, span := s.start(ctx, deleteSpanName, k.Key())
+	defer span.End()
+
+	err := s.underlying.Delete(ctx, k)
+	recordError(span, err)
+
+	return err
+}
+
+func (s *Storage) Exists(ctx context.Context, k microstorage.K) (bool, error) {
+	ctx, span := s.start(ctx, existsSpanName, k.Key())
+	defer span.End()
+
+	exists, err := s.underlying.Exists(ctx, k)
+	if err == nil {
+		span.SetAttributes(FoundAttribute.Bool(exists))
+	}
+	recordError(span, err)
+
+	return exists, err
+}
+
+func (s *Storage) List(ctx context.Context, k microstorage.K) ([]microstorage.KV, error) {
+	ctx, span := s.start(ctx, listSpanName, k.Key())
+	defer span.End()
+
+	list, err := s.underlying.List(ctx, k)
+	if err == nil {
+		span.SetAttributes(ResultCountAttribute.Int(len(list)))
+	}
+	recordError(span, err)
+
+	return list, err
+}
+
+func (s *Storage) Search(ctx context.Context, k microstorage.K) (microstorage.KV, error) {
+	ctx, span := s.start(ctx, searchSpanName, k.Key())
+	defer span.End()
+
+	kv, err := s.underlying.Search(ctx, k)
+	if err == nil {
+		span.SetAttributes(FoundAttribute.Bool(true), ValueSizeAttribute.Int(len(kv.Val())))
+	} else if microstorage.IsNotFound(err) {
+		span.SetAttributes(FoundAttribute.Bool(false))
+	}
+	recordError(span, err)
+
+	return kv, err
+}
+
+func (s *Storage) start(ctx context.Context, name, key string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, name, trace.WithAttributes(KeyAttribute.String(key)))
+}
+
+// recordError records the error on the span. A key which is not found is a
+// regular outcome and does not mark the span as failed.
+func recordError(span trace.Span, err error) {
+	if err == nil || microstorage.IsNotFound(err) {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,227 @@
+package tracestorage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/giantswarm/microstorage"
+	"github.com/giantswarm/microstorage/memory"
+	"github.com/giantswarm/microstorage/storagetest"
+)
+
+// spanStorage records the span found in the context passed by the tracing
+// storage.
+type spanStorage struct {
+	microstorage.Storage
+
+	spanContext trace.SpanContext
+}
+
+func (s *spanStorage) Put(ctx context.Context, kv microstorage.KV) error {
+	s.spanContext = trace.SpanContextFromContext(ctx)
+	return s.Storage.Put(ctx, kv)
+}
+
+// failingStorage fails every Delete.
+type failingStorage struct {
+	microstorage.Storage
+}
+
+func (s *failingStorage) Delete(ctx context.Context, k microstorage.K) error {
+	return errors.New("connection refused")
+}
+
+func newStorage(t *testing.T, underlying microstorage.Storage) (*Storage, *tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	config := DefaultConfig()
+	config.Underlying = underlying
+	config.TracerProvider = provider
+
+	storage, err := New(config)
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage, exporter, provider
+}
+
+func newMemory(t *testing.T) *memory.Storage {
+	storage, err := memory.New(memory.DefaultConfig())
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	return storage
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func Test_Storage(t *testing.T) {
+	storage, _, _ := newStorage(t, newMemory(t))
+	storagetest.Test(t, storage)
+}
+
+func Test_Storage_Spans(t *testing.T) {
+	ctx := context.Background()
+	storage, exporter, _ := newStorage(t, newMemory(t))
+
+	err := storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("a/b", "value")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = storage.Search(ctx, microstorage.MustK(microstorage.NewK("a/b")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = storage.Search(ctx, microstorage.MustK(microstorage.NewK("missing")))
+	if !microstorage.IsNotFound(err) {
+		t.Fatal("expected", microstorage.NotFoundError, "got", err)
+	}
+	_, err = storage.List(ctx, microstorage.MustK(microstorage.NewK("a")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	_, err = storage.Exists(ctx, microstorage.MustK(microstorage.NewK("a")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	err = storage.Delete(ctx, microstorage.MustK(microstorage.NewK("a/b")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+
+	testCases := []struct {
+		name               string
+		expectedAttributes map[attribute.Key]attribute.Value
+	}{
+		{
+			name: putSpanName,
+			expectedAttributes: map[attribute.Key]attribute.Value{
+				KeyAttribute:       attribute.StringValue("/a/b"),
+				ValueSizeAttribute: attribute.IntValue(5),
+			},
+		},
+		{
+			name: searchSpanName,
+			expectedAttributes: map[attribute.Key]attribute.Value{
+				KeyAttribute:       attribute.StringValue("/a/b"),
+				ValueSizeAttribute: attribute.IntValue(5),
+				FoundAttribute:     attribute.BoolValue(true),
+			},
+		},
+		{
+			name: searchSpanName,
+			expectedAttributes: map[attribute.Key]attribute.Value{
+				KeyAttribute:   attribute.StringValue("/missing"),
+				FoundAttribute: attribute.BoolValue(false),
+			},
+		},
+		{
+			name: listSpanName,
+			expectedAttributes: map[attribute.Key]attribute.Value{
+				KeyAttribute:         attribute.StringValue("/a"),
+				ResultCountAttribute: attribute.IntValue(1),
+			},
+		},
+		{
+			name: existsSpanName,
+			expectedAttributes: map[attribute.Key]attribute.Value{
+				KeyAttribute:   attribute.StringValue("/a"),
+				FoundAttribute: attribute.BoolValue(false),
+			},
+		},
+		{
+			name: deleteSpanName,
+			expectedAttributes: map[attribute.Key]attribute.Value{
+				KeyAttribute: attribute.StringValue("/a/b"),
+			},
+		},
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != len(testCases) {
+		t.Fatal("expected", len(testCases), "got", len(spans))
+	}
+
+	for i, tc := range testCases {
+		span := spans[i]
+		if span.Name != tc.name {
+			t.Fatal("expected", tc.name, "got", span.Name)
+		}
+		if span.Status.Code != codes.Unset {
+			t.Fatal("expected", codes.Unset, "got", span.Status.Code)
+		}
+
+		a := attributes(span)
+		if len(a) != len(tc.expectedAttributes) {
+			t.Fatal("expected", tc.expectedAttributes, "got", a)
+		}
+		for k, v := range tc.expectedAttributes {
+			if a[k] != v {
+				t.Fatal("expected", v.Emit(), "got", a[k].Emit())
+			}
+		}
+	}
+}
+
+func Test_Storage_Error(t *testing.T) {
+	storage, exporter, _ := newStorage(t, &failingStorage{Storage: newMemory(t)})
+
+	err := storage.Delete(context.Background(), microstorage.MustK(microstorage.NewK("key")))
+	if err == nil {
+		t.Fatal("expected", "error", "got", nil)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatal("expected", 1, "got", len(spans))
+	}
+	if spans[0].Status.Code != codes.Error {
+		t.Fatal("expected", codes.Error, "got", spans[0].Status.Code)
+	}
+	if len(spans[0].Events) != 1 || spans[0].Events[0].Name != "exception" {
+		t.Fatal("expected", "exception event", "got", spans[0].Events)
+	}
+}
+
+func Test_Storage_Propagation(t *testing.T) {
+	underlying := &spanStorage{Storage: newMemory(t)}
+	storage, exporter, provider := newStorage(t, underlying)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	err := storage.Put(ctx, microstorage.MustKV(microstorage.NewKV("key", "value")))
+	if err != nil {
+		t.Fatal("expected", nil, "got", err)
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatal("expected", 2, "got", len(spans))
+	}
+	put := spans[0]
+
+	// The span of the operation is a child of the caller's span.
+	if put.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected", parent.SpanContext().SpanID(), "got", put.Parent.SpanID())
+	}
+	// The underlying storage gets the span of the operation.
+	if underlying.spanContext.SpanID() != put.SpanContext.SpanID() {
+		t.Fatal("expected", put.SpanContext.SpanID(), "got", underlying.spanContext.SpanID())
+	}
+}
@@ -0,0 +1,204 @@
+package microstorage
+
+import (
+	"context"
+)
+
+// CmpType describes the kind of condition a Cmp checks.
+type CmpType int
+
+const (
+	// CmpExists succeeds when a value is stored under the key.
+	CmpExists CmpType = iota
+	// CmpNotExists succeeds when no value is stored under the key.
+	CmpNotExists
+	// CmpValue succeeds when the value stored under the key equals the
+	// expected one.
+	CmpValue
+	// CmpRevision succeeds when the revision of the value stored under the
+	// key equals the expected one. See RevisionStorage.
+	CmpRevision
+)
+
+// Cmp is an immutable condition evaluated by a transaction against a single
+// key.
+type Cmp struct {
+	typ CmpType
+	key K
+	val string
+	rev int64
+}
+
+// NewCmpExists creates a condition succeeding when the key exists.
+func NewCmpExists(key K) Cmp {
+	return Cmp{typ: CmpExists, key: key}
+}
+
+// NewCmpNotExists creates a condition succeeding when the key does not exist.
+func NewCmpNotExists(key K) Cmp {
+	return Cmp{typ: CmpNotExists, key: key}
+}
+
+// NewCmpValue creates a condition succeeding when the key exists and the value
+// stored under it equals val.
+func NewCmpValue(key K, val string) Cmp {
+	return Cmp{typ: CmpValue, key: key, val: val}
+}
+
+// NewCmpRevision creates a condition succeeding when the key exists and the
+// revision of the value stored under it equals rev.
+func NewCmpRevision(key K, rev int64) Cmp {
+	return Cmp{typ: CmpRevision, key: key, rev: rev}
+}
+
+// Type returns the kind of the condition.
+func (c Cmp) Type() CmpType {
+	return c.typ
+}
+
+// K returns the key the condition is evaluated against.
+func (c Cmp) K() K {
+	return c.key
+}
+
+// Val returns the expected value of a CmpValue condition.
+func (c Cmp) Val() string {
+	return c.val
+}
+
+// Revision returns the expected revision of a CmpRevision condition.
+func (c Cmp) Revision() int64 {
+	return c.rev
+}
+
+// Eval evaluates the condition against the current state of the key. It is
+// intended for use in TxnStorage implementations. The exists argument tells
+// whether a value is stored under the key, in which case val and rev are its
+// value and revision.
+func (c Cmp) Eval(exists bool, val string, rev int64) bool {
+	switch c.typ {
+	case CmpExists:
+		return exists
+	case CmpNotExists:
+		return !exists
+	case CmpValue:
+		return exists && val == c.val
+	case CmpRevision:
+		return exists && rev == c.rev
+	default:
+		return false
+	}
+}
+
+// OpType describes the kind of modification an Op performs.
+type OpType int
+
+const (
+	// OpPut stores a value like Storage.Put.
+	OpPut OpType = iota
+	// OpDelete removes a value like Storage.Delete.
+	OpDelete
+)
+
+// Op is an immutable modification executed as a part of a transaction.
+type Op struct {
+	typ OpType
+	kv  KV
+	key K
+}
+
+// NewOpPut creates an operation storing the given key-value pair.
+func NewOpPut(kv KV) Op {
+	return Op{typ: OpPut, kv: kv, key: kv.K()}
+}
+
+// NewOpDelete creates an operation removing the value stored under the given
+// key.
+func NewOpDelete(key K) Op {
+	return Op{typ: OpDelete, key: key}
+}
+
+// Type returns the kind of the operation.
+func (o Op) Type() OpType {
+	return o.typ
+}
+
+// K returns the key modified by the operation.
+func (o Op) K() K {
+	return o.key
+}
+
+// KV returns the key-value pair stored by an OpPut operation.
+func (o Op) KV() KV {
+	return o.kv
+}
+
+// Txn is a transaction builder. A transaction evaluates all its conditions
+// and, depending on the result, atomically executes either the Then or the
+// Else operations. Conditions are combined with logical AND, and a
+// transaction without conditions always executes the Then operations.
+//
+//	txn := microstorage.NewTxn().
+//		If(microstorage.NewCmpNotExists(k)).
+//		Then(microstorage.NewOpPut(kv), microstorage.NewOpPut(indexKV)).
+//		Else(microstorage.NewOpDelete(staleK))
+type Txn struct {
+	cmps    []Cmp
+	thenOps []Op
+	elseOps []Op
+}
+
+// NewTxn creates a new empty transaction.
+func NewTxn() *Txn {
+	return &Txn{}
+}
+
+// If appends conditions to the transaction.
+func (t *Txn) If(cmps ...Cmp) *Txn {
+	t.cmps = append(t.cmps, cmps...)
+	return t
+}
+
+// Then appends operations executed when all conditions succeed.
+func (t *Txn) Then(ops ...Op) *Txn {
+	t.thenOps = append(t.thenOps, ops...)
+	return t
+}
+
+// Else appends operations executed when any condition fails.
+func (t *Txn) Else(ops ...Op) *Txn {
+	t.elseOps = append(t.elseOps, ops...)
+	return t
+}
+
+// Conditions returns the conditions of the transaction.
+func (t *Txn) Conditions() []Cmp {
+	return t.cmps
+}
+
+// ThenOps returns the operations executed when all conditions succeed.
+func (t *Txn) ThenOps() []Op {
+	return t.thenOps
+}
+
+// ElseOps returns the operations executed when any condition fails.
+func (t *Txn) ElseOps() []Op {
+	return t.elseOps
+}
+
+// TxnResponse is the result of a transaction.
+type TxnResponse struct {
+	// Succeeded tells whether all conditions succeeded and the Then
+	// operations were executed. Otherwise the Else operations were executed.
+	Succeeded bool
+}
+
+// TxnStorage is an optional interface implemented by Storage backends
+// supporting multi-key transactions with all-or-nothing semantics. Use a type
+// assertion to check whether a Storage supports it.
+type TxnStorage interface {
+	// Txn evaluates the conditions and executes the resulting operations
+	// atomically. Either all operations are applied or none of them, and no
+	// other writer can modify the involved keys in between.
+	Txn(ctx context.Context, txn *Txn) (TxnResponse, error)
+}